@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/luc4s023/DesafioObservabilidade/internal/users"
+)
+
+// runImportCommand executa "import [flags] <arquivo>": cria em lote os usuários
+// de um CSV ou NDJSON e imprime o relatório por linha. Devolve o código de
+// saída: 0 se todas as linhas foram (ou seriam) criadas, 1 caso contrário e
+// 2 para argumentos inválidos.
+func runImportCommand(ctx context.Context, service *users.Service, args []string) int {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Uso: usuarios import [-dry-run] [-best-effort] [-format csv|ndjson] <arquivo | ->")
+		fs.PrintDefaults()
+	}
+	dryRun := fs.Bool("dry-run", false, "apenas valida e verifica conflitos, sem gravar")
+	bestEffort := fs.Bool("best-effort", false, "grava as linhas válidas mesmo que outras falhem (padrão: tudo ou nada)")
+	format := fs.String("format", "", "formato do arquivo: csv ou ndjson (padrão: pela extensão)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	path := fs.Arg(0)
+	if *format == "" {
+		*format = strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+		if *format == "jsonl" {
+			*format = users.ImportNDJSON
+		}
+	}
+
+	var in io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Erro ao abrir o arquivo: %v\n", err)
+			return 1
+		}
+		defer f.Close()
+		in = f
+	}
+
+	rows, err := users.ParseImport(in, *format, 0)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Arquivo inválido: %v\n", err)
+		return 1
+	}
+	report, err := service.ImportUsers(ctx, rows, users.ImportOptions{DryRun: *dryRun, BestEffort: *bestEffort})
+	if err != nil && !report.Committed {
+		fmt.Fprintf(os.Stderr, "Erro ao importar usuários: %v\n", err)
+		return 1
+	}
+
+	printImportReport(report)
+	if err != nil {
+		// No modo best-effort as linhas anteriores à falha já foram gravadas;
+		// o relatório acima diz quais.
+		fmt.Fprintf(os.Stderr, "Erro ao importar usuários: %v\n", err)
+		return 1
+	}
+	if report.Conflicts > 0 || report.Invalid > 0 {
+		return 1
+	}
+	return 0
+}
+
+func printImportReport(report users.ImportReport) {
+	for _, row := range report.Rows {
+		if row.Status == users.ImportCreated {
+			continue
+		}
+		line := fmt.Sprintf("Linha %d (%s): %s", row.Line, row.Username, row.Status)
+		for i, e := range row.Errors {
+			sep := "; "
+			if i == 0 {
+				sep = " - "
+			}
+			line += sep + e.Field + ": " + e.Message
+		}
+		fmt.Println(line)
+	}
+
+	created := "criados"
+	switch {
+	case report.DryRun:
+		fmt.Print("Simulação (nada foi gravado): ")
+		created = "seriam criados"
+	case !report.Committed:
+		fmt.Print("Importação desfeita (nada foi gravado): ")
+		created = "seriam criados"
+	case report.NotProcessed > 0:
+		fmt.Print("Importação interrompida (as linhas criadas foram gravadas): ")
+	default:
+		fmt.Print("Importação concluída: ")
+	}
+	fmt.Printf("%d %s, %d em conflito, %d inválidos, %d não processados (modo %s).\n",
+		report.Created, created, report.Conflicts, report.Invalid, report.NotProcessed, report.Mode)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/luc4s023/DesafioObservabilidade/internal/users"
+)
+
+// brokenStore simula a queda do banco a partir do (failAfter+1)-ésimo Create.
+type brokenStore struct {
+	users.Store
+	failAfter int
+	calls     int
+}
+
+func (s *brokenStore) Create(ctx context.Context, u users.User) (users.User, error) {
+	s.calls++
+	if s.calls > s.failAfter {
+		return users.User{}, errors.New("conexão com o banco perdida")
+	}
+	return s.Store.Create(ctx, u)
+}
+
+// captureStdout devolve o que fn imprimiu na saída padrão.
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+	fn()
+	w.Close()
+	out, _ := io.ReadAll(r)
+	return string(out)
+}
+
+func TestRunImportCommandBestEffortFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usuarios.csv")
+	csv := "username,email,password\nana,ana@exemplo.com,segredo1\nbia,bia@exemplo.com,segredo1\ncaio,caio@exemplo.com,segredo1\n"
+	if err := os.WriteFile(path, []byte(csv), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	store := &brokenStore{Store: users.NewMemoryStore(), failAfter: 1}
+	hasher := users.Argon2idHasher{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+	service := users.NewService(store, hasher)
+
+	var code int
+	out := captureStdout(t, func() {
+		code = runImportCommand(context.Background(), service, []string{"-best-effort", path})
+	})
+	if code != 1 {
+		t.Errorf("código de saída %d, quer 1", code)
+	}
+	// Sem o relatório, o operador não saberia que ana já foi gravada.
+	for _, want := range []string{"Linha 3 (bia): not_processed", "Linha 4 (caio): not_processed", "1 criados", "2 não processados"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("saída sem %q:\n%s", want, out)
+		}
+	}
+	if _, err := store.GetByUsername(context.Background(), "ana"); err != nil {
+		t.Errorf("GetByUsername(ana): %v", err)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/luc4s023/DesafioObservabilidade/internal/users"
+)
+
+// clearEnv esvazia as variáveis lidas por loadConfig durante o teste.
+func clearEnv(t *testing.T) {
+	t.Helper()
+	for _, name := range []string{
+		"POSTGRES_DSN", "POSTGRES_DSN_FILE", "PGHOST", "PGPORT", "PGUSER", "PGPASSWORD",
+		"PGPASSWORD_FILE", "PGDATABASE", "PGSSLMODE", "MIGRATE_ON_STARTUP",
+		"PASSWORD_HASH_ALGORITHM", "ARGON2_MEMORY_KIB", "ARGON2_ITERATIONS", "ARGON2_PARALLELISM", "BCRYPT_COST",
+	} {
+		t.Setenv(name, "")
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	const dsn = "postgres://app@localhost:5432/usuarios?sslmode=disable"
+	tests := []struct {
+		name        string
+		env         map[string]string
+		wantErr     string
+		wantMigrate bool
+	}{
+		// Sem banco configurado a CLI não tenta mais um DSN com senha padrão.
+		{"sem banco", nil, "banco de dados não configurado", false},
+		{"com DSN", map[string]string{"POSTGRES_DSN": dsn}, "", false},
+		{"com PGHOST", map[string]string{"PGHOST": "localhost"}, "", false},
+		{"migrações pedidas", map[string]string{"POSTGRES_DSN": dsn, "MIGRATE_ON_STARTUP": "true"}, "", true},
+		{"migrações recusadas", map[string]string{"POSTGRES_DSN": dsn, "MIGRATE_ON_STARTUP": "false"}, "", false},
+		{"MIGRATE_ON_STARTUP inválido", map[string]string{"POSTGRES_DSN": dsn, "MIGRATE_ON_STARTUP": "sim"}, "MIGRATE_ON_STARTUP", false},
+		{"hash inválido", map[string]string{"POSTGRES_DSN": dsn, "ARGON2_PARALLELISM": "256"}, "hash de senha", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+			for name, v := range tt.env {
+				t.Setenv(name, v)
+			}
+			cfg, err := loadConfig()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("loadConfig: erro %v, quer um que contenha %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadConfig: %v", err)
+			}
+			if cfg.MigrateOnStartup != tt.wantMigrate {
+				t.Errorf("MigrateOnStartup = %v, quer %v", cfg.MigrateOnStartup, tt.wantMigrate)
+			}
+			if cfg.Hasher == nil || cfg.Hasher.Algorithm() != users.AlgorithmArgon2id {
+				t.Errorf("Hasher = %v, quer argon2id", cfg.Hasher)
+			}
+		})
+	}
+}
@@ -1,5 +0,0 @@
-module lib/pq
-
-go 1.24.1
-
-require github.com/lib/pq v1.10.9
@@ -0,0 +1,395 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/luc4s023/DesafioObservabilidade/internal/users"
+)
+
+const (
+	sessionCookieName = "session_id"
+
+	// Tipos de credencial guardados na tabela sessions e no claim "typ" dos JWT.
+	tokenKindSession = "session"
+	tokenKindAccess  = "access"
+	tokenKindRefresh = "refresh"
+
+	loginModeSession = "session"
+	loginModeToken   = "token"
+)
+
+var errUnauthenticated = errors.New("não autenticado")
+
+// authConfig reúne o segredo de assinatura dos JWT, as validades das
+// credenciais e as opções do cookie de sessão.
+type authConfig struct {
+	JWTSecret       []byte
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	SessionTTL      time.Duration
+	CookieSecure    bool
+	CookieSameSite  http.SameSite
+}
+
+var authCfg authConfig
+
+// defaultAuthConfig devolve a configuração sem segredo; ver config.validate
+// para a ausência de AUTH_JWT_SECRET. Use SameSite none quando a UI é
+// servida noutro domínio.
+func defaultAuthConfig() authConfig {
+	return authConfig{
+		AccessTokenTTL:  15 * time.Minute,
+		RefreshTokenTTL: 7 * 24 * time.Hour,
+		SessionTTL:      12 * time.Hour,
+		CookieSecure:    true,
+		CookieSameSite:  http.SameSiteLaxMode,
+	}
+}
+
+type LoginPayload struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	// Mode escolhe a credencial emitida: "session" (cookie HttpOnly, o padrão)
+	// ou "token" (par de JWT access/refresh).
+	Mode string `json:"mode"`
+}
+
+type RefreshPayload struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+type tokenClaims struct {
+	Username string `json:"username"`
+	Role     string `json:"role"`
+	Type     string `json:"typ"`
+	jwt.RegisteredClaims
+}
+
+// authIdentity é o utilizador autenticado numa requisição.
+type authIdentity struct {
+	UserID   int64
+	Username string
+	Role     string
+	// Method indica a credencial usada: "session" ou "token".
+	Method string
+}
+
+func (s *server) loginHandler(w http.ResponseWriter, r *http.Request) {
+	var payload LoginPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		authLoginTotal.WithLabelValues("failure", "bad_request").Inc()
+		writeProblem(w, r, http.StatusBadRequest, errorTypeBadRequest, "Corpo da requisição inválido: "+err.Error())
+		return
+	}
+	if payload.Mode == "" {
+		payload.Mode = loginModeSession
+	}
+	if payload.Mode != loginModeSession && payload.Mode != loginModeToken {
+		authLoginTotal.WithLabelValues("failure", "bad_request").Inc()
+		writeProblem(w, r, http.StatusBadRequest, errorTypeBadRequest, "Modo de login inválido. Use 'session' ou 'token'")
+		return
+	}
+
+	user, err := s.svc.AuthenticateUser(r.Context(), payload.Username, payload.Password)
+	if err != nil {
+		if errors.Is(err, users.ErrInvalidCredentials) {
+			authLoginTotal.WithLabelValues("failure", "invalid_credentials").Inc()
+			slog.WarnContext(r.Context(), "Login recusado", "username", payload.Username, "reason", "invalid_credentials")
+			writeProblem(w, r, http.StatusUnauthorized, errorTypeInvalidCredentials, "Nome de utilizador ou senha inválidos")
+			return
+		}
+		authLoginTotal.WithLabelValues("failure", "internal_error").Inc()
+		slog.ErrorContext(r.Context(), "Erro ao autenticar utilizador", "error", err, "username", payload.Username)
+		writeProblem(w, r, http.StatusInternalServerError, errorTypeInternal, "Erro interno ao autenticar utilizador")
+		return
+	}
+	ctx := withUserID(r.Context(), user.ID)
+
+	if payload.Mode == loginModeToken {
+		pair, err := s.issueTokenPair(ctx, user)
+		if err != nil {
+			authLoginTotal.WithLabelValues("failure", "internal_error").Inc()
+			slog.ErrorContext(ctx, "Erro ao emitir tokens", "error", err)
+			writeProblem(w, r, http.StatusInternalServerError, errorTypeInternal, "Erro interno ao autenticar utilizador")
+			return
+		}
+		authLoginTotal.WithLabelValues("success", "ok").Inc()
+		slog.InfoContext(ctx, "Login efetuado", "mode", payload.Mode)
+		writeJSON(w, http.StatusOK, pair)
+		return
+	}
+
+	token := randomToken()
+	expiresAt := time.Now().Add(authCfg.SessionTTL)
+	if err := s.store.CreateSession(ctx, users.Session{ID: hashToken(token), UserID: user.ID, Kind: tokenKindSession, ExpiresAt: expiresAt}); err != nil {
+		authLoginTotal.WithLabelValues("failure", "internal_error").Inc()
+		slog.ErrorContext(ctx, "Erro ao criar sessão", "error", err)
+		writeProblem(w, r, http.StatusInternalServerError, errorTypeInternal, "Erro interno ao autenticar utilizador")
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    token,
+		Path:     "/",
+		Expires:  expiresAt,
+		MaxAge:   int(authCfg.SessionTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   authCfg.CookieSecure,
+		SameSite: authCfg.CookieSameSite,
+	})
+	authLoginTotal.WithLabelValues("success", "ok").Inc()
+	slog.InfoContext(ctx, "Login efetuado", "mode", payload.Mode)
+	writeJSON(w, http.StatusOK, user)
+}
+
+// logoutHandler encerra a sessão do cookie e/ou revoga o refresh token
+// enviado no corpo. Access tokens continuam válidos até expirarem.
+func (s *server) logoutHandler(w http.ResponseWriter, r *http.Request) {
+	if c, err := r.Cookie(sessionCookieName); err == nil && c.Value != "" {
+		if _, err := s.store.DeleteSession(r.Context(), hashToken(c.Value), tokenKindSession, time.Now()); err != nil {
+			slog.ErrorContext(r.Context(), "Erro ao encerrar sessão", "error", err)
+			writeProblem(w, r, http.StatusInternalServerError, errorTypeInternal, "Erro interno ao encerrar sessão")
+			return
+		}
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   authCfg.CookieSecure,
+		SameSite: authCfg.CookieSameSite,
+	})
+
+	var payload RefreshPayload
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			writeProblem(w, r, http.StatusBadRequest, errorTypeBadRequest, "Corpo da requisição inválido: "+err.Error())
+			return
+		}
+	}
+	if payload.RefreshToken != "" {
+		claims, err := parseToken(payload.RefreshToken, tokenKindRefresh)
+		if err == nil {
+			if _, err := s.store.DeleteSession(r.Context(), claims.ID, tokenKindRefresh, time.Now()); err != nil {
+				slog.ErrorContext(r.Context(), "Erro ao revogar refresh token", "error", err)
+				writeProblem(w, r, http.StatusInternalServerError, errorTypeInternal, "Erro interno ao encerrar sessão")
+				return
+			}
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// refreshHandler troca um refresh token válido por um novo par de tokens. O
+// refresh token usado é revogado (rotação), então só pode ser usado uma vez.
+func (s *server) refreshHandler(w http.ResponseWriter, r *http.Request) {
+	var payload RefreshPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, errorTypeBadRequest, "Corpo da requisição inválido: "+err.Error())
+		return
+	}
+
+	claims, err := parseToken(payload.RefreshToken, tokenKindRefresh)
+	if err != nil {
+		writeProblem(w, r, http.StatusUnauthorized, errorTypeUnauthenticated, "Refresh token inválido ou expirado")
+		return
+	}
+	userID, err := strconv.ParseInt(claims.Subject, 10, 64)
+	if err != nil {
+		writeProblem(w, r, http.StatusUnauthorized, errorTypeUnauthenticated, "Refresh token inválido ou expirado")
+		return
+	}
+	ctx := withUserID(r.Context(), userID)
+
+	revoked, err := s.store.DeleteSession(ctx, claims.ID, tokenKindRefresh, time.Now())
+	if err != nil {
+		slog.ErrorContext(ctx, "Erro ao revogar refresh token", "error", err)
+		writeProblem(w, r, http.StatusInternalServerError, errorTypeInternal, "Erro interno ao renovar tokens")
+		return
+	}
+	if !revoked {
+		slog.WarnContext(ctx, "Refresh token já utilizado ou revogado", "jti", claims.ID)
+		writeProblem(w, r, http.StatusUnauthorized, errorTypeUnauthenticated, "Refresh token inválido ou expirado")
+		return
+	}
+
+	// Recarrega o utilizador para que o novo access token reflita o papel atual.
+	user, err := s.store.GetByID(ctx, userID)
+	if errors.Is(err, users.ErrNotFound) || err == nil && user.Status == users.StatusDisabled {
+		writeProblem(w, r, http.StatusUnauthorized, errorTypeUnauthenticated, "Refresh token inválido ou expirado")
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Erro ao buscar utilizador para renovar tokens", "error", err)
+		writeProblem(w, r, http.StatusInternalServerError, errorTypeInternal, "Erro interno ao renovar tokens")
+		return
+	}
+
+	pair, err := s.issueTokenPair(ctx, user)
+	if err != nil {
+		slog.ErrorContext(ctx, "Erro ao emitir tokens", "error", err)
+		writeProblem(w, r, http.StatusInternalServerError, errorTypeInternal, "Erro interno ao renovar tokens")
+		return
+	}
+	writeJSON(w, http.StatusOK, pair)
+}
+
+// meHandler devolve o utilizador autenticado pela sessão ou pelo bearer token.
+func (s *server) meHandler(w http.ResponseWriter, r *http.Request) {
+	identity, err := s.authenticateRequest(r)
+	if err != nil {
+		if err != errUnauthenticated {
+			slog.ErrorContext(r.Context(), "Erro ao autenticar requisição", "error", err)
+			writeProblem(w, r, http.StatusInternalServerError, errorTypeInternal, "Erro interno ao buscar utilizador")
+			return
+		}
+		writeProblem(w, r, http.StatusUnauthorized, errorTypeUnauthenticated, "Não autenticado")
+		return
+	}
+	ctx := withUserID(r.Context(), identity.UserID)
+
+	user, err := s.store.GetByID(ctx, identity.UserID)
+	if errors.Is(err, users.ErrNotFound) || err == nil && user.Status != users.StatusActive {
+		writeProblem(w, r, http.StatusUnauthorized, errorTypeUnauthenticated, "Não autenticado")
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Erro ao buscar utilizador autenticado", "error", err)
+		writeProblem(w, r, http.StatusInternalServerError, errorTypeInternal, "Erro interno ao buscar utilizador")
+		return
+	}
+	writeJSON(w, http.StatusOK, user)
+}
+
+// authenticateRequest identifica o utilizador pelo cabeçalho
+// "Authorization: Bearer <access token>" ou, na falta dele, pelo cookie de sessão.
+func (s *server) authenticateRequest(r *http.Request) (authIdentity, error) {
+	if h := r.Header.Get("Authorization"); h != "" {
+		token, ok := strings.CutPrefix(h, "Bearer ")
+		if !ok {
+			return authIdentity{}, errUnauthenticated
+		}
+		claims, err := parseToken(token, tokenKindAccess)
+		if err != nil {
+			return authIdentity{}, errUnauthenticated
+		}
+		userID, err := strconv.ParseInt(claims.Subject, 10, 64)
+		if err != nil {
+			return authIdentity{}, errUnauthenticated
+		}
+		return s.reloadIdentity(r.Context(), authIdentity{UserID: userID, Method: loginModeToken})
+	}
+
+	c, err := r.Cookie(sessionCookieName)
+	if err != nil || c.Value == "" {
+		return authIdentity{}, errUnauthenticated
+	}
+	user, err := s.store.GetSessionUser(r.Context(), hashToken(c.Value), tokenKindSession, time.Now())
+	if errors.Is(err, users.ErrSessionNotFound) {
+		return authIdentity{}, errUnauthenticated
+	}
+	if err != nil {
+		return authIdentity{}, err
+	}
+	return authIdentity{UserID: user.ID, Username: user.Username, Role: user.Role, Method: loginModeSession}, nil
+}
+
+func (s *server) issueTokenPair(ctx context.Context, user users.User) (TokenPair, error) {
+	now := time.Now()
+
+	access, err := signToken(user, tokenKindAccess, randomToken(), now, authCfg.AccessTokenTTL)
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	refreshID := randomToken()
+	refresh, err := signToken(user, tokenKindRefresh, refreshID, now, authCfg.RefreshTokenTTL)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	if err := s.store.CreateSession(ctx, users.Session{ID: refreshID, UserID: user.ID, Kind: tokenKindRefresh, ExpiresAt: now.Add(authCfg.RefreshTokenTTL)}); err != nil {
+		return TokenPair{}, err
+	}
+
+	return TokenPair{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(authCfg.AccessTokenTTL.Seconds()),
+	}, nil
+}
+
+func signToken(user users.User, kind, id string, now time.Time, ttl time.Duration) (string, error) {
+	claims := tokenClaims{
+		Username: user.Username,
+		Role:     user.Role,
+		Type:     kind,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    serviceName,
+			Subject:   strconv.FormatInt(user.ID, 10),
+			ID:        id,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	}
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(authCfg.JWTSecret)
+	if err != nil {
+		return "", fmt.Errorf("erro ao assinar token: %v", err)
+	}
+	return signed, nil
+}
+
+func parseToken(token, kind string) (*tokenClaims, error) {
+	claims := &tokenClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (any, error) {
+		return authCfg.JWTSecret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithIssuer(serviceName), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, err
+	}
+	if claims.Type != kind {
+		return nil, fmt.Errorf("tipo de token inesperado: %q", claims.Type)
+	}
+	return claims, nil
+}
+
+// randomToken gera 32 bytes aleatórios em hexadecimal.
+func randomToken() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// hashToken é usado para guardar o token de sessão no banco sem o valor do cookie.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/luc4s023/DesafioObservabilidade/internal/users"
+)
+
+// testHasher é propositadamente barato: os testes não medem o custo do hash.
+var testHasher = users.Argon2idHasher{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+// withTestAuthConfig usa um segredo fixo durante o teste e restaura authCfg no fim.
+func withTestAuthConfig(t *testing.T) {
+	t.Helper()
+	saved := authCfg
+	t.Cleanup(func() { authCfg = saved })
+	authCfg = defaultAuthConfig()
+	authCfg.JWTSecret = []byte("segredo-de-teste-com-mais-de-32-caracteres")
+}
+
+// newTestServer devolve um server com o armazenamento em memória e a
+// configuração padrão, restaurando as variáveis globais no fim do teste.
+func newTestServer(t *testing.T) *server {
+	t.Helper()
+	withTestAuthConfig(t)
+	cors, idem := corsCfg, idempotencyCfg
+	t.Cleanup(func() { corsCfg, idempotencyCfg = cors, idem })
+	corsCfg = defaultCORSPolicy()
+	idempotencyCfg = defaultIdempotencyConfig()
+	return newServer(users.NewMemoryStore(), testHasher)
+}
+
+// mustRegister regista username com a senha "segredo123" e, se role não for
+// vazio, atribui-lhe esse papel.
+func mustRegister(t *testing.T, s *server, username, role string) users.User {
+	t.Helper()
+	ctx := context.Background()
+	user, err := s.svc.RegisterUser(ctx, username, username+"@exemplo.com", "segredo123")
+	if err != nil {
+		t.Fatalf("RegisterUser(%q): %v", username, err)
+	}
+	if role != "" {
+		if _, err := s.svc.SetUserRole(ctx, username, role); err != nil {
+			t.Fatalf("SetUserRole(%q): %v", username, err)
+		}
+		if user, err = s.store.GetByID(ctx, user.ID); err != nil {
+			t.Fatalf("GetByID(%d): %v", user.ID, err)
+		}
+	}
+	return user
+}
+
+// serve envia req a h registado em pattern ("GET /api/users") num ServeMux
+// próprio, com os middlewares de apiRoute.
+func serve(pattern string, h http.HandlerFunc, req *http.Request) *httptest.ResponseRecorder {
+	_, route, _ := strings.Cut(pattern, " ")
+	mux := http.NewServeMux()
+	mux.HandleFunc(pattern, apiRoute(route, h))
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	return rec
+}
+
+func jsonRequest(method, target, body string) *http.Request {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req
+}
+
+// checkProblem confirma que rec é um problem+json com o status e o código indicados.
+func checkProblem(t *testing.T, rec *httptest.ResponseRecorder, status int, code string) {
+	t.Helper()
+	if rec.Code != status {
+		t.Fatalf("status %d, quer %d (corpo: %s)", rec.Code, status, rec.Body)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != problemContentType {
+		t.Errorf("Content-Type %q, quer %q", ct, problemContentType)
+	}
+	var p problem
+	if err := json.NewDecoder(rec.Body).Decode(&p); err != nil {
+		t.Fatalf("corpo problem+json inválido: %v", err)
+	}
+	if p.Code != code || p.Status != status || p.Type != problemTypePrefix+code {
+		t.Errorf("problem %+v, quer code %q e status %d", p, code, status)
+	}
+}
+
+func login(t *testing.T, s *server, username, mode string) *httptest.ResponseRecorder {
+	t.Helper()
+	body := `{"username":"` + username + `","password":"segredo123","mode":"` + mode + `"}`
+	return serve("POST /api/auth/login", s.loginHandler, jsonRequest(http.MethodPost, "/api/auth/login", body))
+}
+
+func loginToken(t *testing.T, s *server, username string) TokenPair {
+	t.Helper()
+	rec := login(t, s, username, loginModeToken)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("login de %q: status %d (%s)", username, rec.Code, rec.Body)
+	}
+	var pair TokenPair
+	if err := json.NewDecoder(rec.Body).Decode(&pair); err != nil {
+		t.Fatalf("login de %q: %v", username, err)
+	}
+	return pair
+}
+
+func bearer(req *http.Request, token string) *http.Request {
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req
+}
+
+func TestParseToken(t *testing.T) {
+	withTestAuthConfig(t)
+	user := users.User{ID: 7, Username: "ana"}
+	now := time.Now()
+
+	access, err := signToken(user, tokenKindAccess, "jti-1", now, time.Minute)
+	if err != nil {
+		t.Fatalf("signToken: %v", err)
+	}
+	claims, err := parseToken(access, tokenKindAccess)
+	if err != nil {
+		t.Fatalf("parseToken: %v", err)
+	}
+	if claims.Subject != "7" || claims.Username != "ana" || claims.ID != "jti-1" {
+		t.Errorf("claims %+v, quer sub 7, ana e jti-1", claims)
+	}
+
+	expired, _ := signToken(user, tokenKindAccess, "jti-2", now.Add(-time.Hour), time.Minute)
+	tests := map[string]string{
+		"tipo errado": access,
+		"expirado":    expired,
+		"adulterado":  access[:len(access)-2] + "xx",
+		"lixo":        "nao-e-um-jwt",
+	}
+	for name, token := range tests {
+		kind := tokenKindAccess
+		if name == "tipo errado" {
+			kind = tokenKindRefresh
+		}
+		if _, err := parseToken(token, kind); err == nil {
+			t.Errorf("%s: parseToken aceitou o token", name)
+		}
+	}
+
+	// Um token assinado com outro segredo não é aceito.
+	authCfg.JWTSecret = []byte("outro-segredo-de-teste-com-mais-de-32-caracteres")
+	if _, err := parseToken(access, tokenKindAccess); err == nil {
+		t.Error("parseToken aceitou um token assinado com outro segredo")
+	}
+}
+
+func TestAuthHandlersRejectBadRequests(t *testing.T) {
+	s := newTestServer(t)
+	refresh, _ := signToken(users.User{ID: 7, Username: "ana"}, tokenKindRefresh, "jti-1", time.Now(), time.Minute)
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		req     *http.Request
+		want    int
+		code    string
+	}{
+		{"login com JSON inválido", s.loginHandler, jsonRequest(http.MethodPost, "/api/auth/login", "{"), http.StatusBadRequest, errorTypeBadRequest},
+		{"login com modo inválido", s.loginHandler, jsonRequest(http.MethodPost, "/api/auth/login", `{"username":"ana","password":"segredo123","mode":"outro"}`), http.StatusBadRequest, errorTypeBadRequest},
+		{"me sem credenciais", s.meHandler, httptest.NewRequest(http.MethodGet, "/api/auth/me", nil), http.StatusUnauthorized, errorTypeUnauthenticated},
+		{"me com esquema errado", s.meHandler, func() *http.Request {
+			req := httptest.NewRequest(http.MethodGet, "/api/auth/me", nil)
+			req.Header.Set("Authorization", "Basic YW5hOnNlZ3JlZG8=")
+			return req
+		}(), http.StatusUnauthorized, errorTypeUnauthenticated},
+		// Um refresh token não serve como access token.
+		{"me com refresh token", s.meHandler, bearer(httptest.NewRequest(http.MethodGet, "/api/auth/me", nil), refresh), http.StatusUnauthorized, errorTypeUnauthenticated},
+		{"refresh com token inválido", s.refreshHandler, jsonRequest(http.MethodPost, "/api/auth/refresh", `{"refresh_token":"lixo"}`), http.StatusUnauthorized, errorTypeUnauthenticated},
+		{"logout sem credenciais", s.logoutHandler, httptest.NewRequest(http.MethodPost, "/api/auth/logout", nil), http.StatusNoContent, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			tt.handler(rec, tt.req)
+			if tt.code == "" {
+				if rec.Code != tt.want {
+					t.Errorf("status %d, quer %d (corpo: %s)", rec.Code, tt.want, rec.Body)
+				}
+				return
+			}
+			checkProblem(t, rec, tt.want, tt.code)
+		})
+	}
+}
+
+func TestLoginInvalidCredentials(t *testing.T) {
+	s := newTestServer(t)
+	mustRegister(t, s, "ana", "")
+
+	for _, body := range []string{
+		`{"username":"ana","password":"errada123"}`,
+		`{"username":"ninguem","password":"segredo123"}`,
+	} {
+		rec := serve("POST /api/auth/login", s.loginHandler, jsonRequest(http.MethodPost, "/api/auth/login", body))
+		checkProblem(t, rec, http.StatusUnauthorized, errorTypeInvalidCredentials)
+	}
+}
+
+func TestSessionLoginAndLogout(t *testing.T) {
+	s := newTestServer(t)
+	mustRegister(t, s, "ana", "")
+
+	rec := login(t, s, "ana", loginModeSession)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("login: status %d (%s)", rec.Code, rec.Body)
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != sessionCookieName || !cookies[0].HttpOnly || !cookies[0].Secure {
+		t.Fatalf("cookies %+v, quer %s HttpOnly e Secure", cookies, sessionCookieName)
+	}
+	session := cookies[0]
+
+	me := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/auth/me", nil)
+		req.AddCookie(session)
+		return serve("GET /api/auth/me", s.meHandler, req)
+	}
+	rec = me()
+	var user users.User
+	if err := json.NewDecoder(rec.Body).Decode(&user); rec.Code != http.StatusOK || err != nil || user.Username != "ana" {
+		t.Fatalf("me: status %d, utilizador %+v, erro %v", rec.Code, user, err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/logout", nil)
+	req.AddCookie(session)
+	if rec := serve("POST /api/auth/logout", s.logoutHandler, req); rec.Code != http.StatusNoContent {
+		t.Fatalf("logout: status %d (%s)", rec.Code, rec.Body)
+	}
+	checkProblem(t, me(), http.StatusUnauthorized, errorTypeUnauthenticated)
+}
+
+func TestRefreshRotatesTokens(t *testing.T) {
+	s := newTestServer(t)
+	mustRegister(t, s, "ana", "")
+	first := loginToken(t, s, "ana")
+
+	refresh := func(token string) *httptest.ResponseRecorder {
+		body := `{"refresh_token":"` + token + `"}`
+		return serve("POST /api/auth/refresh", s.refreshHandler, jsonRequest(http.MethodPost, "/api/auth/refresh", body))
+	}
+	rec := refresh(first.RefreshToken)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("refresh: status %d (%s)", rec.Code, rec.Body)
+	}
+	var second TokenPair
+	if err := json.NewDecoder(rec.Body).Decode(&second); err != nil || second.RefreshToken == first.RefreshToken {
+		t.Fatalf("refresh devolveu %+v (%v), quer um novo refresh token", second, err)
+	}
+
+	// O refresh token usado foi revogado na rotação.
+	checkProblem(t, refresh(first.RefreshToken), http.StatusUnauthorized, errorTypeUnauthenticated)
+	// Um access token não serve como refresh token.
+	checkProblem(t, refresh(second.AccessToken), http.StatusUnauthorized, errorTypeUnauthenticated)
+
+	body := `{"refresh_token":"` + second.RefreshToken + `"}`
+	if rec := serve("POST /api/auth/logout", s.logoutHandler, jsonRequest(http.MethodPost, "/api/auth/logout", body)); rec.Code != http.StatusNoContent {
+		t.Fatalf("logout: status %d (%s)", rec.Code, rec.Body)
+	}
+	checkProblem(t, refresh(second.RefreshToken), http.StatusUnauthorized, errorTypeUnauthenticated)
+}
+
+func TestDeletedUserTokenRejected(t *testing.T) {
+	s := newTestServer(t)
+	bia := mustRegister(t, s, "bia", "")
+	pair := loginToken(t, s, "bia")
+
+	me := func() *httptest.ResponseRecorder {
+		return serve("GET /api/auth/me", s.meHandler, bearer(httptest.NewRequest(http.MethodGet, "/api/auth/me", nil), pair.AccessToken))
+	}
+	if rec := me(); rec.Code != http.StatusOK {
+		t.Fatalf("me antes de apagar: status %d (%s)", rec.Code, rec.Body)
+	}
+	if err := s.svc.DeleteUserByID(context.Background(), bia.ID, 0); err != nil {
+		t.Fatalf("DeleteUserByID: %v", err)
+	}
+
+	// O access token continua assinado e dentro da validade, mas o
+	// utilizador já não existe.
+	checkProblem(t, me(), http.StatusUnauthorized, errorTypeUnauthenticated)
+	req := bearer(httptest.NewRequest(http.MethodGet, "/api/user?username=bia", nil), pair.AccessToken)
+	rec := serve("GET /api/user", s.requireAuth(s.getUserByUsernameHandler), req)
+	checkProblem(t, rec, http.StatusUnauthorized, errorTypeUnauthenticated)
+}
+
+func TestDisabledUserTokenRejected(t *testing.T) {
+	s := newTestServer(t)
+	bia := mustRegister(t, s, "bia", "")
+	pair := loginToken(t, s, "bia")
+
+	me := func() *httptest.ResponseRecorder {
+		return serve("GET /api/auth/me", s.meHandler, bearer(httptest.NewRequest(http.MethodGet, "/api/auth/me", nil), pair.AccessToken))
+	}
+	if rec := me(); rec.Code != http.StatusOK {
+		t.Fatalf("me antes de desativar: status %d (%s)", rec.Code, rec.Body)
+	}
+
+	disabled := users.StatusDisabled
+	if _, err := s.svc.UpdateUser(context.Background(), bia.ID, 0, users.UserUpdate{Status: &disabled}); err != nil {
+		t.Fatalf("UpdateUser: %v", err)
+	}
+
+	// O access token continua assinado e dentro da validade, mas o
+	// utilizador já não está ativo.
+	checkProblem(t, me(), http.StatusUnauthorized, errorTypeUnauthenticated)
+	req := bearer(httptest.NewRequest(http.MethodGet, "/api/users/1", nil), pair.AccessToken)
+	rec := serve("GET /api/users/{id}", s.requireAuth(s.getUserHandler), req)
+	checkProblem(t, rec, http.StatusUnauthorized, errorTypeUnauthenticated)
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/luc4s023/DesafioObservabilidade/internal/users"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var authzDeniedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: metricsNamespace,
+	Name:      "authz_denied_total",
+	Help:      "Requisições negadas pela autorização, por rota e motivo.",
+}, []string{"route", "reason"})
+
+func withIdentity(ctx context.Context, identity authIdentity) context.Context {
+	ctx = context.WithValue(ctx, identityKey, identity)
+	return withUserID(ctx, identity.UserID)
+}
+
+// identityFromContext devolve o utilizador autenticado por requireAuth.
+func identityFromContext(ctx context.Context) (authIdentity, bool) {
+	identity, ok := ctx.Value(identityKey).(authIdentity)
+	return identity, ok
+}
+
+func (i authIdentity) IsAdmin() bool {
+	return i.Role == users.RoleAdmin
+}
+
+// CanAccessUser indica se o utilizador autenticado pode ler ou alterar o
+// registo do utilizador userID: administradores podem todos, os demais só o próprio.
+func (i authIdentity) CanAccessUser(userID int64) bool {
+	return i.IsAdmin() || i.UserID == userID
+}
+
+// requireAuth responde 401 quando a requisição não traz sessão ou bearer token
+// válido e, caso contrário, guarda a identidade no contexto.
+func (s *server) requireAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity, err := s.authenticateRequest(r)
+		if err != nil {
+			if err != errUnauthenticated {
+				slog.ErrorContext(r.Context(), "Erro ao autenticar requisição", "error", err)
+				writeProblem(w, r, http.StatusInternalServerError, errorTypeInternal, "Erro interno ao autenticar requisição")
+				return
+			}
+			denyAccess(w, r, http.StatusUnauthorized, "unauthenticated")
+			return
+		}
+		next(w, r.WithContext(withIdentity(r.Context(), identity)))
+	}
+}
+
+// reloadIdentity relê do banco o papel e o estado do dono de um access token.
+// Os claims são os da emissão do token; sem isso, um utilizador desativado,
+// removido ou despromovido manteria o acesso até o token expirar. As sessões
+// do cookie já são lidas do banco a cada requisição.
+func (s *server) reloadIdentity(ctx context.Context, identity authIdentity) (authIdentity, error) {
+	user, err := s.store.GetByID(ctx, identity.UserID)
+	if errors.Is(err, users.ErrNotFound) || err == nil && user.Status != users.StatusActive {
+		return authIdentity{}, errUnauthenticated
+	}
+	if err != nil {
+		return authIdentity{}, err
+	}
+	identity.Username, identity.Role = user.Username, user.Role
+	return identity, nil
+}
+
+// requireRole exige autenticação e o papel indicado, respondendo 403 aos demais.
+func (s *server) requireRole(role string, next http.HandlerFunc) http.HandlerFunc {
+	return s.requireAuth(func(w http.ResponseWriter, r *http.Request) {
+		identity, _ := identityFromContext(r.Context())
+		if identity.Role != role {
+			denyAccess(w, r, http.StatusForbidden, "missing_role_"+role)
+			return
+		}
+		next(w, r)
+	})
+}
+
+// denyAccess responde 401/403 e registra a negação no log de auditoria.
+func denyAccess(w http.ResponseWriter, r *http.Request, status int, reason string) {
+	route, _ := r.Context().Value(routeKey).(string)
+	authzDeniedTotal.WithLabelValues(route, reason).Inc()
+
+	attrs := []any{
+		"audit", true,
+		"reason", reason,
+		"method", r.Method,
+		"path", r.URL.Path,
+		"remote_addr", r.RemoteAddr,
+		"status", status,
+	}
+	if identity, ok := identityFromContext(r.Context()); ok {
+		attrs = append(attrs, "role", identity.Role)
+	}
+	slog.WarnContext(r.Context(), "Acesso negado", attrs...)
+
+	if status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="`+serviceName+`"`)
+		writeProblem(w, r, status, errorTypeUnauthenticated, "Não autenticado")
+		return
+	}
+	writeProblem(w, r, status, errorTypeForbidden, "Acesso negado")
+}
+
+// bootstrapAdmins promove a administrador os utilizadores listados em
+// BOOTSTRAP_ADMIN_USERNAMES, para que exista ao menos um administrador após
+// a primeira instalação. Como o registo é aberto, qualquer um pode criar uma
+// conta com um desses nomes; por isso nada é promovido se já existir um
+// administrador, e a lista só deve ser definida depois de registada a conta.
+func bootstrapAdmins(ctx context.Context, svc *users.Service, usernames []string) {
+	if len(usernames) == 0 {
+		return
+	}
+	exists, err := svc.HasAdmin(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "Erro ao promover administrador", "error", err)
+		return
+	}
+	if exists {
+		slog.InfoContext(ctx, "Administrador já existe; BOOTSTRAP_ADMIN_USERNAMES ignorada")
+		return
+	}
+	for _, username := range usernames {
+		promoted, err := svc.SetUserRole(ctx, username, users.RoleAdmin)
+		if err != nil {
+			slog.ErrorContext(ctx, "Erro ao promover administrador", "error", err, "username", username)
+			continue
+		}
+		if promoted {
+			slog.InfoContext(ctx, "Utilizador promovido a administrador", "audit", true, "username", username)
+		}
+	}
+}
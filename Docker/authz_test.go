@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"testing"
+
+	"github.com/luc4s023/DesafioObservabilidade/internal/users"
+)
+
+func TestRequireRole(t *testing.T) {
+	s := newTestServer(t)
+	mustRegister(t, s, "ana", users.RoleAdmin)
+	mustRegister(t, s, "bia", "")
+	admin := loginToken(t, s, "ana")
+	user := loginToken(t, s, "bia")
+
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	list := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/users", nil)
+		if token != "" {
+			bearer(req, token)
+		}
+		return serve("GET /api/users", s.requireRole(users.RoleAdmin, ok), req)
+	}
+
+	for name, token := range map[string]string{"sem token": "", "lixo": "nao-e-um-jwt", "refresh token": admin.RefreshToken} {
+		rec := list(token)
+		if rec.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%s: 401 sem WWW-Authenticate", name)
+		}
+		checkProblem(t, rec, http.StatusUnauthorized, errorTypeUnauthenticated)
+	}
+	checkProblem(t, list(user.AccessToken), http.StatusForbidden, errorTypeForbidden)
+	if rec := list(admin.AccessToken); rec.Code != http.StatusOK {
+		t.Errorf("admin: status %d (%s)", rec.Code, rec.Body)
+	}
+
+	// O papel vem do banco, não do token: despromovido, o admin perde o acesso.
+	if _, err := s.svc.SetUserRole(context.Background(), "ana", users.RoleUser); err != nil {
+		t.Fatalf("SetUserRole: %v", err)
+	}
+	checkProblem(t, list(admin.AccessToken), http.StatusForbidden, errorTypeForbidden)
+}
+
+func TestOwnUserAccess(t *testing.T) {
+	s := newTestServer(t)
+	mustRegister(t, s, "ana", users.RoleAdmin)
+	bia := mustRegister(t, s, "bia", "")
+	caio := mustRegister(t, s, "caio", "")
+	admin := loginToken(t, s, "ana")
+	user := loginToken(t, s, "bia")
+
+	get := func(id int64, token string) *httptest.ResponseRecorder {
+		req := bearer(httptest.NewRequest(http.MethodGet, "/api/users/"+strconv.FormatInt(id, 10), nil), token)
+		return serve("GET /api/users/{id}", s.requireAuth(s.getUserHandler), req)
+	}
+	if rec := get(bia.ID, user.AccessToken); rec.Code != http.StatusOK {
+		t.Errorf("próprio registo: status %d (%s)", rec.Code, rec.Body)
+	}
+	checkProblem(t, get(caio.ID, user.AccessToken), http.StatusForbidden, errorTypeForbidden)
+	if rec := get(caio.ID, admin.AccessToken); rec.Code != http.StatusOK {
+		t.Errorf("admin: status %d (%s)", rec.Code, rec.Body)
+	}
+}
+
+func TestSearchOnlyOwnUser(t *testing.T) {
+	s := newTestServer(t)
+	mustRegister(t, s, "ana", users.RoleAdmin)
+	mustRegister(t, s, "bia", "")
+	mustRegister(t, s, "bianca", "")
+	admin := loginToken(t, s, "ana")
+	user := loginToken(t, s, "bia")
+
+	search := func(token string) []string {
+		t.Helper()
+		req := bearer(httptest.NewRequest(http.MethodGet, "/api/user?username=bia", nil), token)
+		rec := serve("GET /api/user", s.requireAuth(s.getUserByUsernameHandler), req)
+		var found []users.User
+		if err := json.NewDecoder(rec.Body).Decode(&found); rec.Code != http.StatusOK || err != nil {
+			t.Fatalf("status %d, erro %v", rec.Code, err)
+		}
+		var names []string
+		for _, u := range found {
+			names = append(names, u.Username)
+		}
+		return names
+	}
+	if got, want := search(user.AccessToken), []string{"bia"}; !slices.Equal(got, want) {
+		t.Errorf("utilizador comum encontrou %v, quer %v", got, want)
+	}
+	if got, want := search(admin.AccessToken), []string{"bia", "bianca"}; !slices.Equal(got, want) {
+		t.Errorf("admin encontrou %v, quer %v", got, want)
+	}
+}
+
+func TestBootstrapAdminsOnlyWithoutAdmin(t *testing.T) {
+	s := newTestServer(t)
+	ctx := context.Background()
+	mustRegister(t, s, "ana", "")
+	mustRegister(t, s, "bia", "")
+
+	role := func(username string) string {
+		t.Helper()
+		u, err := s.store.GetByUsername(ctx, username)
+		if err != nil {
+			t.Fatalf("GetByUsername(%q): %v", username, err)
+		}
+		return u.Role
+	}
+
+	bootstrapAdmins(ctx, s.svc, []string{"ana", "ninguem"})
+	if got := role("ana"); got != users.RoleAdmin {
+		t.Fatalf("ana: papel %q, quer %q", got, users.RoleAdmin)
+	}
+
+	// Com um administrador já existente, a lista é ignorada.
+	bootstrapAdmins(ctx, s.svc, []string{"bia"})
+	if got := role("bia"); got != users.RoleUser {
+		t.Errorf("bia: papel %q, quer %q", got, users.RoleUser)
+	}
+}
+
+func TestCanAccessUser(t *testing.T) {
+	tests := []struct {
+		name     string
+		identity authIdentity
+		userID   int64
+		want     bool
+	}{
+		{"próprio registo", authIdentity{UserID: 1, Role: users.RoleUser}, 1, true},
+		{"outro utilizador", authIdentity{UserID: 1, Role: users.RoleUser}, 2, false},
+		{"admin", authIdentity{UserID: 1, Role: users.RoleAdmin}, 2, true},
+		{"sem papel", authIdentity{UserID: 1}, 2, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.identity.CanAccessUser(tt.userID); got != tt.want {
+				t.Errorf("CanAccessUser(%d) = %v, quer %v", tt.userID, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,587 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/luc4s023/DesafioObservabilidade/internal/users"
+	"gopkg.in/yaml.v3"
+)
+
+// Ambientes aceitos em APP_ENV.
+const (
+	envDevelopment = "development"
+	envProduction  = "production"
+)
+
+// minJWTSecretLen é o tamanho mínimo de AUTH_JWT_SECRET fora de
+// desenvolvimento, o mesmo dos segredos gerados por randomToken em bytes.
+const minJWTSecretLen = 32
+
+// storeConfig escolhe o armazenamento de utilizadores; ver openStore.
+type storeConfig struct {
+	// Backend é "postgres", "sqlite" ou "memory".
+	Backend string
+	// Postgres diz de onde vêm o DSN e as credenciais; ver users.PostgresSource.
+	Postgres users.PostgresSource
+	// SecretRefreshInterval é o intervalo entre verificações dos ficheiros
+	// de segredo do Postgres; 0 desativa a recarga.
+	SecretRefreshInterval time.Duration
+	SQLitePath            string
+	MigrateOnStartup      bool
+	// MaxOpenConns limita as conexões do pool do Postgres; 0 não limita.
+	MaxOpenConns int
+	// MaxIdleConns é o número de conexões ociosas mantidas; 0 não mantém
+	// nenhuma.
+	MaxIdleConns int
+	// ConnMaxLifetime e ConnMaxIdleTime fecham as conexões mais antigas ou
+	// ociosas há mais tempo que isso; 0 não as limita.
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+	// ConnectTimeout é o prazo total de espera pelo banco ao subir; 0 tenta
+	// uma única vez. Entre as tentativas, a espera dobra de
+	// ConnectBackoffInitial até ConnectBackoffMax.
+	ConnectTimeout        time.Duration
+	ConnectBackoffInitial time.Duration
+	ConnectBackoffMax     time.Duration
+}
+
+func defaultStoreConfig() storeConfig {
+	return storeConfig{
+		Backend:               "postgres",
+		SecretRefreshInterval: 30 * time.Second,
+		SQLitePath:            "usuarios.db",
+		MaxOpenConns:          25,
+		MaxIdleConns:          10,
+		ConnMaxLifetime:       30 * time.Minute,
+		ConnMaxIdleTime:       5 * time.Minute,
+		ConnectTimeout:        2 * time.Minute,
+		ConnectBackoffInitial: 500 * time.Millisecond,
+		ConnectBackoffMax:     15 * time.Second,
+	}
+}
+
+type logConfig struct {
+	// Level é debug, info, warn ou error.
+	Level string
+	// Format é json ou text.
+	Format string
+}
+
+// telemetryConfig configura a exportação dos spans; ver initTracing.
+type telemetryConfig struct {
+	// TracesExporter é "otlp" ou "none".
+	TracesExporter string
+	// OTLPEndpoint é a URL base do coletor ("http://jaeger:4318"); vazio usa
+	// as variáveis OTEL_EXPORTER_OTLP_TRACES_* do SDK.
+	OTLPEndpoint string
+	// OTLPProtocol é "http/protobuf" ou "grpc".
+	OTLPProtocol string
+}
+
+// config é a configuração efetiva do servidor. Cada opção tem um valor
+// padrão e pode vir, em ordem crescente de precedência, do ficheiro YAML
+// (-config ou CONFIG_FILE), de uma variável de ambiente ou de uma flag.
+type config struct {
+	Env             string
+	HTTP            serverConfig
+	Store           storeConfig
+	Log             logConfig
+	Telemetry       telemetryConfig
+	CORS            corsPolicy
+	Auth            authConfig
+	Password        users.PasswordConfig
+	Idempotency     idempotencyConfig
+	BootstrapAdmins []string
+
+	// File é o ficheiro YAML lido, se algum.
+	File string
+
+	settings []*setting
+}
+
+// Origens de um valor da configuração, exibidas em /api/admin/config.
+const (
+	sourceDefault = "default"
+	sourceFile    = "file"
+	sourceEnv     = "env"
+	sourceFlag    = "flag"
+)
+
+// setting liga uma opção da config à sua chave no YAML ("http.addr"), à
+// variável de ambiente e à flag (a chave com "-": -http-addr).
+type setting struct {
+	key   string
+	env   string
+	usage string
+	// secret oculta o valor em /api/admin/config; redact, se definido, oculta
+	// apenas a parte sensível.
+	secret bool
+	redact func(string) string
+	set    func(string) error
+	get    func() string
+	source string
+}
+
+func (s *setting) flagName() string {
+	return strings.NewReplacer(".", "-", "_", "-").Replace(s.key)
+}
+
+// displayValue é o valor exibido fora do processo, sem segredos.
+func (s *setting) displayValue() string {
+	v := s.get()
+	switch {
+	case v == "":
+		return ""
+	case s.secret:
+		return "[REDACTED]"
+	case s.redact != nil:
+		return s.redact(v)
+	}
+	return v
+}
+
+func (c *config) add(key, env, usage string, set func(string) error, get func() string) *setting {
+	s := &setting{key: key, env: env, usage: usage, set: set, get: get, source: sourceDefault}
+	c.settings = append(c.settings, s)
+	return s
+}
+
+func (c *config) str(key, env string, p *string, usage string) *setting {
+	return c.add(key, env, usage, func(v string) error { *p = v; return nil }, func() string { return *p })
+}
+
+func (c *config) duration(key, env string, p *time.Duration, usage string) *setting {
+	return c.add(key, env, usage, func(v string) error {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return fmt.Errorf("duração inválida %q (use o formato 10s, 5m, 24h)", v)
+		}
+		*p = d
+		return nil
+	}, func() string { return p.String() })
+}
+
+func (c *config) integer(key, env string, p *int, usage string) *setting {
+	return c.add(key, env, usage, func(v string) error {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("inteiro inválido %q", v)
+		}
+		*p = n
+		return nil
+	}, func() string { return strconv.Itoa(*p) })
+}
+
+func (c *config) boolean(key, env string, p *bool, usage string) *setting {
+	return c.add(key, env, usage, func(v string) error {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("booleano inválido %q (use true ou false)", v)
+		}
+		*p = b
+		return nil
+	}, func() string { return strconv.FormatBool(*p) })
+}
+
+// list lê listas separadas por vírgula (no YAML, também sequências).
+func (c *config) list(key, env string, p *[]string, usage string) *setting {
+	return c.add(key, env, usage, func(v string) error { *p = splitList(v); return nil },
+		func() string { return strings.Join(*p, ",") })
+}
+
+// newConfig devolve a configuração com os valores padrão e regista as opções.
+func newConfig() *config {
+	c := &config{
+		Env:         envDevelopment,
+		HTTP:        defaultServerConfig(),
+		Store:       defaultStoreConfig(),
+		Log:         logConfig{Level: "info", Format: "json"},
+		Telemetry:   telemetryConfig{TracesExporter: "otlp", OTLPProtocol: "http/protobuf"},
+		CORS:        defaultCORSPolicy(),
+		Auth:        defaultAuthConfig(),
+		Password:    users.DefaultPasswordConfig(),
+		Idempotency: defaultIdempotencyConfig(),
+	}
+
+	c.str("env", "APP_ENV", &c.Env, "ambiente: development ou production (valida os valores obrigatórios)")
+
+	c.str("http.addr", "HTTP_ADDR", &c.HTTP.Addr, "endereço de escuta do servidor HTTP")
+	c.duration("http.read_timeout", "HTTP_READ_TIMEOUT", &c.HTTP.ReadTimeout, "tempo máximo para ler a requisição")
+	c.duration("http.read_header_timeout", "HTTP_READ_HEADER_TIMEOUT", &c.HTTP.ReadHeaderTimeout, "tempo máximo para ler os cabeçalhos")
+	c.duration("http.write_timeout", "HTTP_WRITE_TIMEOUT", &c.HTTP.WriteTimeout, "tempo máximo para escrever a resposta")
+	c.duration("http.idle_timeout", "HTTP_IDLE_TIMEOUT", &c.HTTP.IdleTimeout, "tempo máximo de uma conexão keep-alive ociosa")
+	c.duration("http.shutdown_delay", "SHUTDOWN_DELAY", &c.HTTP.ShutdownDelay, "espera com /readyz a falhar antes de parar de aceitar conexões")
+	c.duration("http.shutdown_timeout", "SHUTDOWN_TIMEOUT", &c.HTTP.ShutdownTimeout, "espera máxima pelas requisições em andamento no encerramento")
+
+	c.str("store.backend", "STORE_BACKEND", &c.Store.Backend, "armazenamento: postgres, sqlite ou memory")
+	pg := &c.Store.Postgres
+	c.str("store.postgres.dsn", "POSTGRES_DSN", &pg.DSN, "string de conexão do PostgreSQL").redact = users.RedactDSN
+	c.str("store.postgres.dsn_file", "POSTGRES_DSN_FILE", &pg.DSNFile, "ficheiro com a string de conexão do PostgreSQL")
+	c.str("store.postgres.host", "PGHOST", &pg.Host, "host do PostgreSQL (substitui o do DSN)")
+	c.str("store.postgres.port", "PGPORT", &pg.Port, "porta do PostgreSQL (substitui a do DSN)")
+	c.str("store.postgres.user", "PGUSER", &pg.User, "utilizador do PostgreSQL (substitui o do DSN)")
+	c.str("store.postgres.password", "PGPASSWORD", &pg.Password, "senha do PostgreSQL (prefira PGPASSWORD_FILE)").secret = true
+	c.str("store.postgres.password_file", "PGPASSWORD_FILE", &pg.PasswordFile, "ficheiro com a senha do PostgreSQL")
+	c.str("store.postgres.database", "PGDATABASE", &pg.Database, "banco de dados do PostgreSQL (substitui o do DSN)")
+	c.str("store.postgres.sslmode", "PGSSLMODE", &pg.SSLMode, "sslmode do PostgreSQL (substitui o do DSN)")
+	c.duration("store.postgres.secret_refresh_interval", "POSTGRES_SECRET_REFRESH_INTERVAL", &c.Store.SecretRefreshInterval, "intervalo entre verificações dos ficheiros de segredo (0 desativa)")
+	c.str("store.sqlite_path", "SQLITE_PATH", &c.Store.SQLitePath, "ficheiro do SQLite")
+	c.boolean("store.migrate_on_startup", "MIGRATE_ON_STARTUP", &c.Store.MigrateOnStartup, "aplica as migrações pendentes ao subir")
+	c.integer("store.max_open_conns", "DB_MAX_OPEN_CONNS", &c.Store.MaxOpenConns, "conexões abertas no máximo no pool do PostgreSQL (0 não limita)")
+	c.integer("store.max_idle_conns", "DB_MAX_IDLE_CONNS", &c.Store.MaxIdleConns, "conexões ociosas mantidas no pool do PostgreSQL")
+	c.duration("store.conn_max_lifetime", "DB_CONN_MAX_LIFETIME", &c.Store.ConnMaxLifetime, "tempo de vida máximo de uma conexão do PostgreSQL (0 não limita)")
+	c.duration("store.conn_max_idle_time", "DB_CONN_MAX_IDLE_TIME", &c.Store.ConnMaxIdleTime, "tempo máximo de uma conexão ociosa do PostgreSQL (0 não limita)")
+	c.duration("store.connect_timeout", "DB_CONNECT_TIMEOUT", &c.Store.ConnectTimeout, "prazo total de espera pelo PostgreSQL ao subir (0 tenta uma vez)")
+	c.duration("store.connect_backoff_initial", "DB_CONNECT_BACKOFF_INITIAL", &c.Store.ConnectBackoffInitial, "espera antes da segunda tentativa de conexão ao PostgreSQL")
+	c.duration("store.connect_backoff_max", "DB_CONNECT_BACKOFF_MAX", &c.Store.ConnectBackoffMax, "espera máxima entre tentativas de conexão ao PostgreSQL")
+
+	c.str("log.level", "LOG_LEVEL", &c.Log.Level, "nível mínimo de log: debug, info, warn ou error")
+	c.str("log.format", "LOG_FORMAT", &c.Log.Format, "formato do log: json ou text")
+
+	c.str("telemetry.traces_exporter", "OTEL_TRACES_EXPORTER", &c.Telemetry.TracesExporter, "exportador de spans: otlp ou none")
+	c.str("telemetry.otlp_endpoint", "OTEL_EXPORTER_OTLP_ENDPOINT", &c.Telemetry.OTLPEndpoint, "URL base do coletor OTLP")
+	c.str("telemetry.otlp_protocol", "OTEL_EXPORTER_OTLP_PROTOCOL", &c.Telemetry.OTLPProtocol, "protocolo OTLP: http/protobuf ou grpc")
+
+	c.list("cors.allowed_origins", "CORS_ALLOWED_ORIGINS", &c.CORS.AllowedOrigins, "origens autorizadas (exatas, https://*.dominio ou *)")
+	c.add("cors.allowed_methods", "CORS_ALLOWED_METHODS", "métodos autorizados nos preflights",
+		func(v string) error { c.CORS.AllowedMethods = splitList(strings.ToUpper(v)); return nil },
+		func() string { return strings.Join(c.CORS.AllowedMethods, ",") })
+	c.list("cors.allowed_headers", "CORS_ALLOWED_HEADERS", &c.CORS.AllowedHeaders, "cabeçalhos autorizados nos preflights")
+	c.list("cors.exposed_headers", "CORS_EXPOSED_HEADERS", &c.CORS.ExposedHeaders, "cabeçalhos da resposta expostos ao navegador")
+	c.boolean("cors.allow_credentials", "CORS_ALLOW_CREDENTIALS", &c.CORS.AllowCredentials, "autoriza cookies e Authorization em CORS")
+	c.duration("cors.max_age", "CORS_MAX_AGE", &c.CORS.MaxAge, "validade do preflight no navegador")
+	c.boolean("cors.trust_forwarded_proto", "CORS_TRUST_FORWARDED_PROTO", &c.CORS.TrustForwardedProto, "usa X-Forwarded-Proto como esquema da requisição (só atrás de um proxy TLS)")
+
+	c.add("auth.jwt_secret", "AUTH_JWT_SECRET", "segredo de assinatura dos JWT",
+		func(v string) error { c.Auth.JWTSecret = []byte(v); return nil },
+		func() string { return string(c.Auth.JWTSecret) }).secret = true
+	c.duration("auth.access_token_ttl", "AUTH_ACCESS_TOKEN_TTL", &c.Auth.AccessTokenTTL, "validade do access token")
+	c.duration("auth.refresh_token_ttl", "AUTH_REFRESH_TOKEN_TTL", &c.Auth.RefreshTokenTTL, "validade do refresh token")
+	c.duration("auth.session_ttl", "AUTH_SESSION_TTL", &c.Auth.SessionTTL, "validade da sessão por cookie")
+	c.boolean("auth.cookie_secure", "AUTH_COOKIE_SECURE", &c.Auth.CookieSecure, "envia o cookie de sessão só por HTTPS")
+	c.add("auth.cookie_samesite", "AUTH_COOKIE_SAMESITE", "SameSite do cookie de sessão: lax, strict ou none",
+		func(v string) error {
+			mode, ok := sameSiteModes[strings.ToLower(v)]
+			if !ok {
+				return fmt.Errorf("valor inválido %q (use lax, strict ou none)", v)
+			}
+			c.Auth.CookieSameSite = mode
+			return nil
+		},
+		func() string {
+			for name, mode := range sameSiteModes {
+				if mode == c.Auth.CookieSameSite {
+					return name
+				}
+			}
+			return ""
+		})
+	c.list("auth.bootstrap_admins", "BOOTSTRAP_ADMIN_USERNAMES", &c.BootstrapAdmins, "utilizadores promovidos a administrador ao subir, se ainda não existir nenhum")
+
+	c.str("password.algorithm", "PASSWORD_HASH_ALGORITHM", &c.Password.Algorithm, "algoritmo dos novos hashes de senha: argon2id ou bcrypt")
+	c.integer("password.argon2_memory_kib", "ARGON2_MEMORY_KIB", &c.Password.Argon2MemoryKiB, "memória do argon2id por hash, em KiB")
+	c.integer("password.argon2_iterations", "ARGON2_ITERATIONS", &c.Password.Argon2Iterations, "iterações do argon2id")
+	c.integer("password.argon2_parallelism", "ARGON2_PARALLELISM", &c.Password.Argon2Parallelism, "paralelismo do argon2id (1 a 255)")
+	c.integer("password.bcrypt_cost", "BCRYPT_COST", &c.Password.BcryptCost, "custo do bcrypt (4 a 31)")
+
+	c.duration("idempotency.ttl", "IDEMPOTENCY_TTL", &c.Idempotency.TTL, "tempo em que as respostas com Idempotency-Key são repetidas")
+	c.duration("idempotency.lock_timeout", "IDEMPOTENCY_LOCK_TIMEOUT", &c.Idempotency.LockTimeout, "tempo máximo de reserva de uma Idempotency-Key em andamento")
+	c.duration("idempotency.purge_interval", "IDEMPOTENCY_PURGE_INTERVAL", &c.Idempotency.PurgeInterval, "intervalo entre remoções das Idempotency-Keys expiradas")
+	return c
+}
+
+var sameSiteModes = map[string]http.SameSite{
+	"lax":    http.SameSiteLaxMode,
+	"strict": http.SameSiteStrictMode,
+	"none":   http.SameSiteNoneMode,
+}
+
+// loadConfig monta a configuração a partir dos valores padrão, do ficheiro
+// YAML, das variáveis de ambiente e, por último, das flags em args. Variáveis
+// de ambiente vazias são ignoradas. Os erros de todas as opções inválidas são
+// devolvidos juntos; -h devolve flag.ErrHelp.
+func loadConfig(args []string) (*config, error) {
+	c := newConfig()
+
+	fs := flag.NewFlagSet(serviceName, flag.ContinueOnError)
+	configFile := fs.String("config", os.Getenv("CONFIG_FILE"), "ficheiro YAML de configuração (CONFIG_FILE)")
+	flagValues := map[string]string{}
+	for _, s := range c.settings {
+		fs.Func(s.flagName(), s.usage+" ("+s.env+")", func(v string) error {
+			flagValues[s.key] = v
+			return nil
+		})
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("argumento inesperado: %q", fs.Arg(0))
+	}
+
+	var errs []error
+	if *configFile != "" {
+		c.File = *configFile
+		if err := c.loadFile(*configFile); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, s := range c.settings {
+		if v := os.Getenv(s.env); v != "" {
+			errs = append(errs, s.apply(v, sourceEnv, s.env))
+		}
+	}
+	for _, s := range c.settings {
+		if v, ok := flagValues[s.key]; ok {
+			errs = append(errs, s.apply(v, sourceFlag, "-"+s.flagName()))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (s *setting) apply(v, source, origin string) error {
+	if err := s.set(v); err != nil {
+		return fmt.Errorf("%s (%s): %v", s.key, origin, err)
+	}
+	s.source = source
+	return nil
+}
+
+// loadFile aplica as chaves do YAML, aninhadas como em "http: {addr: ...}".
+// Chaves desconhecidas são erros, para que um erro de digitação não passe
+// despercebido.
+func (c *config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("erro ao ler o ficheiro de configuração: %v", err)
+	}
+	var doc map[string]any
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("erro ao interpretar o ficheiro de configuração %s: %v", path, err)
+	}
+
+	values := map[string]any{}
+	flattenYAML("", doc, values)
+	keys := slices.Sorted(func(yield func(string) bool) {
+		for k := range values {
+			if !yield(k) {
+				return
+			}
+		}
+	})
+
+	var errs []error
+	for _, key := range keys {
+		i := slices.IndexFunc(c.settings, func(s *setting) bool { return s.key == key })
+		if i < 0 {
+			errs = append(errs, fmt.Errorf("%s: chave desconhecida em %s", key, path))
+			continue
+		}
+		errs = append(errs, c.settings[i].apply(yamlString(values[key]), sourceFile, path))
+	}
+	return errors.Join(errs...)
+}
+
+func flattenYAML(prefix string, node map[string]any, out map[string]any) {
+	for k, v := range node {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+		if child, ok := v.(map[string]any); ok {
+			flattenYAML(key, child, out)
+			continue
+		}
+		out[key] = v
+	}
+}
+
+// yamlString converte um valor do YAML para o texto aceito pelos setters;
+// sequências viram listas separadas por vírgula.
+func yamlString(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case []any:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = fmt.Sprint(item)
+		}
+		return strings.Join(items, ",")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// validate confere os valores e completa os que faltam. Em produção, valores
+// obrigatórios ausentes são erros; fora dela são substituídos por valores de
+// desenvolvimento e devolvidos como avisos.
+func (c *config) validate() (warnings []string, err error) {
+	var errs []error
+	invalid := func(key, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+	}
+	production := c.Env == envProduction
+
+	if c.Env != envDevelopment && c.Env != envProduction {
+		invalid("env", "ambiente inválido %q (use development ou production)", c.Env)
+	}
+	if _, _, err := net.SplitHostPort(c.HTTP.Addr); err != nil {
+		invalid("http.addr", "endereço inválido %q (use host:porta ou :porta)", c.HTTP.Addr)
+	}
+
+	switch c.Store.Backend {
+	case "postgres", "sqlite":
+	case "memory":
+		if production {
+			invalid("store.backend", "memory não persiste dados e não é permitido em produção")
+		}
+	default:
+		invalid("store.backend", "armazenamento desconhecido %q (use postgres, sqlite ou memory)", c.Store.Backend)
+	}
+	switch pg := &c.Store.Postgres; {
+	case !pg.Configured() && c.Store.Backend == "postgres":
+		// Sem um DSN padrão: um deploy que esqueça APP_ENV não deve ligar-se
+		// com uma senha conhecida.
+		invalid("store.postgres", "obrigatório com o backend postgres (POSTGRES_DSN, POSTGRES_DSN_FILE ou PGHOST e PGPASSWORD_FILE); para desenvolvimento sem banco use STORE_BACKEND=sqlite")
+	case !pg.Configured():
+	case c.Store.Backend == "postgres":
+		// Lê os ficheiros já aqui, para falhar antes de subir.
+		if _, err := pg.Resolve(); err != nil {
+			invalid("store.postgres", "%v", err)
+		}
+	default:
+		if err := pg.Validate(); err != nil {
+			invalid("store.postgres", "%v", err)
+		}
+	}
+	if c.Store.MaxOpenConns < 0 {
+		invalid("store.max_open_conns", "não pode ser negativo")
+	}
+	if c.Store.ConnectBackoffInitial <= 0 {
+		invalid("store.connect_backoff_initial", "deve ser maior que zero")
+	}
+	if c.Store.ConnectBackoffMax < c.Store.ConnectBackoffInitial {
+		invalid("store.connect_backoff_max", "não pode ser menor que store.connect_backoff_initial")
+	}
+	if c.Store.MaxIdleConns < 0 {
+		invalid("store.max_idle_conns", "não pode ser negativo")
+	}
+	if c.Store.MaxOpenConns > 0 && c.Store.MaxIdleConns > c.Store.MaxOpenConns {
+		// O database/sql faria o mesmo, sem avisar.
+		warnings = append(warnings, fmt.Sprintf("DB_MAX_IDLE_CONNS (%d) maior que DB_MAX_OPEN_CONNS; usando %d",
+			c.Store.MaxIdleConns, c.Store.MaxOpenConns))
+		c.Store.MaxIdleConns = c.Store.MaxOpenConns
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Log.Level)); err != nil {
+		invalid("log.level", "nível inválido %q (use debug, info, warn ou error)", c.Log.Level)
+	}
+	if c.Log.Format != "json" && c.Log.Format != "text" {
+		invalid("log.format", "formato inválido %q (use json ou text)", c.Log.Format)
+	}
+
+	switch c.Telemetry.TracesExporter {
+	case "otlp", "none":
+	default:
+		invalid("telemetry.traces_exporter", "exportador inválido %q (use otlp ou none)", c.Telemetry.TracesExporter)
+	}
+	if c.Telemetry.OTLPProtocol != "http/protobuf" && c.Telemetry.OTLPProtocol != "grpc" {
+		invalid("telemetry.otlp_protocol", "protocolo OTLP não suportado %q (use grpc ou http/protobuf)", c.Telemetry.OTLPProtocol)
+	}
+	if e := c.Telemetry.OTLPEndpoint; e != "" {
+		if u, err := url.Parse(e); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			invalid("telemetry.otlp_endpoint", "URL inválida %q (ex.: http://jaeger:4318)", e)
+		}
+	}
+
+	for key, d := range map[string]time.Duration{
+		"auth.access_token_ttl":    c.Auth.AccessTokenTTL,
+		"auth.refresh_token_ttl":   c.Auth.RefreshTokenTTL,
+		"auth.session_ttl":         c.Auth.SessionTTL,
+		"idempotency.ttl":          c.Idempotency.TTL,
+		"idempotency.lock_timeout": c.Idempotency.LockTimeout,
+	} {
+		if d <= 0 {
+			invalid(key, "deve ser maior que zero")
+		}
+	}
+	switch secret := string(c.Auth.JWTSecret); {
+	case secret == "" && production:
+		invalid("auth.jwt_secret", "obrigatório em produção (AUTH_JWT_SECRET)")
+	case secret == "":
+		warnings = append(warnings, "AUTH_JWT_SECRET não definida; usando segredo aleatório (tokens inválidos após reinício e entre réplicas)")
+		c.Auth.JWTSecret = []byte(randomToken())
+	case isPlaceholder(secret) || len(secret) < minJWTSecretLen:
+		// Quem conhece o segredo forja tokens de qualquer utilizador, inclusive administradores.
+		msg := fmt.Sprintf("AUTH_JWT_SECRET é um exemplo ou tem menos de %d caracteres (gere um com: openssl rand -hex 32)", minJWTSecretLen)
+		if production {
+			invalid("auth.jwt_secret", "%s", msg)
+		} else {
+			warnings = append(warnings, msg)
+		}
+	}
+	if _, err := users.NewPasswordHasher(c.Password); err != nil {
+		invalid("password", "%v", err)
+	}
+	if c.CORS.AllowCredentials && slices.Contains(c.CORS.AllowedOrigins, "*") {
+		invalid("cors.allow_credentials", "não pode ser usada com a origem \"*\"; liste as origens autorizadas em CORS_ALLOWED_ORIGINS")
+	}
+	if c.Auth.CookieSameSite == http.SameSiteNoneMode && !c.Auth.CookieSecure {
+		// Os navegadores recusam SameSite=None sem Secure.
+		c.Auth.CookieSecure = true
+		warnings = append(warnings, "AUTH_COOKIE_SAMESITE=none exige cookie Secure; AUTH_COOKIE_SECURE ignorada")
+	}
+
+	slices.SortFunc(errs, func(a, b error) int { return strings.Compare(a.Error(), b.Error()) })
+	return warnings, errors.Join(errs...)
+}
+
+// isPlaceholder reconhece valores de exemplo como "<digite_um_segredo>".
+func isPlaceholder(v string) bool {
+	return strings.HasPrefix(v, "<") && strings.HasSuffix(v, ">")
+}
+
+// configEntry é uma opção em /api/admin/config.
+type configEntry struct {
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	Source string `json:"source"`
+	Env    string `json:"env"`
+	Flag   string `json:"flag"`
+}
+
+// entries devolve todas as opções com os segredos ocultos.
+func (c *config) entries() []configEntry {
+	out := make([]configEntry, len(c.settings))
+	for i, s := range c.settings {
+		out[i] = configEntry{Key: s.key, Value: s.displayValue(), Source: s.source, Env: s.env, Flag: "-" + s.flagName()}
+	}
+	return out
+}
+
+// configHandler devolve a configuração efetiva, com a origem de cada valor e
+// sem segredos.
+func (s *server) configHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, map[string]any{
+		"env":      s.config.Env,
+		"file":     s.config.File,
+		"settings": s.config.entries(),
+	})
+}
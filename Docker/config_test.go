@@ -0,0 +1,49 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestConfigValidate(t *testing.T) {
+	// Variáveis vazias são ignoradas: só contam as flags de cada caso.
+	for _, s := range newConfig().settings {
+		t.Setenv(s.env, "")
+	}
+	t.Setenv("CONFIG_FILE", "")
+
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{"memory em desenvolvimento", []string{"-store-backend=memory"}, ""},
+		{"sqlite sem Postgres", []string{"-store-backend=sqlite"}, ""},
+		{"postgres sem DSN", nil, "store.postgres: obrigatório com o backend postgres"},
+		{"postgres com DSN", []string{"-store-postgres-dsn=postgres://app:x@db/app"}, ""},
+		{"memory em produção", []string{"-env=production", "-store-backend=memory", "-auth-jwt-secret=" + strings.Repeat("a", 32)}, "store.backend"},
+		{"segredo curto em produção", []string{"-env=production", "-store-backend=sqlite", "-auth-jwt-secret=" + strings.Repeat("a", minJWTSecretLen-1)}, "auth.jwt_secret"},
+		{"segredo de exemplo em produção", []string{"-env=production", "-store-backend=sqlite", "-auth-jwt-secret=<" + strings.Repeat("a", minJWTSecretLen) + ">"}, "auth.jwt_secret"},
+		{"segredo curto em desenvolvimento", []string{"-store-backend=sqlite", "-auth-jwt-secret=curto"}, ""},
+		{"paralelismo do argon2id acima de 255", []string{"-store-backend=memory", "-password-argon2-parallelism=256"}, "password:"},
+		{"memória do argon2id abaixo do mínimo", []string{"-store-backend=memory", "-password-argon2-memory-kib=8"}, "password:"},
+		{"custo do bcrypt acima do máximo", []string{"-store-backend=memory", "-password-algorithm=bcrypt", "-password-bcrypt-cost=32"}, "password:"},
+		{"algoritmo desconhecido", []string{"-store-backend=memory", "-password-algorithm=md5"}, "password:"},
+		{"credenciais com qualquer origem", []string{"-store-backend=memory", "-cors-allowed-origins=*", "-cors-allow-credentials=true"}, "cors.allow_credentials"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := loadConfig(tt.args)
+			if err != nil {
+				t.Fatalf("loadConfig: %v", err)
+			}
+			_, err = c.validate()
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("validate: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("validate: %v, quer um erro com %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// corsPolicy descreve quais origens de outros domínios podem chamar a API.
+type corsPolicy struct {
+	// AllowedOrigins aceita origens exatas ("https://app.exemplo.com"),
+	// curingas de subdomínio ("https://*.exemplo.com") ou "*" para qualquer origem.
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	MaxAge           time.Duration
+	// TrustForwardedProto usa o X-Forwarded-Proto como esquema da requisição
+	// em sameOrigin. Só deve ser ativado atrás de um proxy que termina o TLS
+	// e define sempre o cabeçalho.
+	TrustForwardedProto bool
+}
+
+var corsCfg = defaultCORSPolicy()
+
+func defaultCORSPolicy() corsPolicy {
+	return corsPolicy{
+		AllowedMethods: []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions},
+		AllowedHeaders: []string{"Accept", "Content-Type", "Authorization", "If-Match", "If-None-Match", idempotencyKeyHeader, requestIDHeader},
+		ExposedHeaders: []string{"ETag", "Link", nextCursorHeader, idempotentReplayedHeader, requestIDHeader},
+		MaxAge:         10 * time.Minute,
+	}
+}
+
+func splitList(v string) []string {
+	var out []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// originAllowed compara a origem com a lista de permitidas, aceitando
+// curingas de subdomínio ("https://*.exemplo.com" cobre "https://a.exemplo.com",
+// mas não "https://exemplo.com").
+func (p corsPolicy) originAllowed(origin string) bool {
+	for _, allowed := range p.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+		scheme, host, ok := strings.Cut(allowed, "://*.")
+		if !ok {
+			continue
+		}
+		prefix := strings.ToLower(scheme + "://")
+		suffix := "." + strings.ToLower(host)
+		o := strings.ToLower(origin)
+		if strings.HasPrefix(o, prefix) && strings.HasSuffix(o, suffix) && len(o) > len(prefix)+len(suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p corsPolicy) methodAllowed(method string) bool {
+	return slices.Contains(p.AllowedMethods, strings.ToUpper(method))
+}
+
+func (p corsPolicy) headersAllowed(requested string) bool {
+	for _, h := range splitList(requested) {
+		if !slices.ContainsFunc(p.AllowedHeaders, func(a string) bool { return strings.EqualFold(a, h) }) {
+			return false
+		}
+	}
+	return true
+}
+
+// sameOrigin indica se a origem é a da própria requisição (esquema, host e
+// porta), caso em que o navegador não aplica CORS. Comparar só o host
+// trataria http://api.exemplo como a origem de um servidor HTTPS.
+func (p corsPolicy) sameOrigin(r *http.Request, origin string) bool {
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if p.TrustForwardedProto {
+		if proto, _, _ := strings.Cut(r.Header.Get("X-Forwarded-Proto"), ","); proto != "" {
+			scheme = strings.ToLower(strings.TrimSpace(proto))
+		}
+	}
+	return strings.EqualFold(u.Scheme, scheme) && strings.EqualFold(hostWithPort(u.Host, scheme), hostWithPort(r.Host, scheme))
+}
+
+// hostWithPort acrescenta a host a porta padrão do esquema, se faltar.
+func hostWithPort(host, scheme string) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	port := "80"
+	if scheme == "https" {
+		port = "443"
+	}
+	return net.JoinHostPort(strings.Trim(host, "[]"), port)
+}
+
+// enableCORS aplica a política de CORS configurada: responde aos preflights
+// com 204 e recusa com 403 as origens, métodos e cabeçalhos não permitidos.
+func enableCORS(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p := corsCfg
+		origin := r.Header.Get("Origin")
+		w.Header().Add("Vary", "Origin")
+
+		if origin == "" || p.sameOrigin(r, origin) {
+			next(w, r)
+			return
+		}
+
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		if !p.originAllowed(origin) {
+			rejectCORS(w, r, origin, "origin_not_allowed")
+			return
+		}
+
+		if slices.Contains(p.AllowedOrigins, "*") {
+			// Nunca com credenciais: qualquer site poderia chamar a API com o
+			// cookie de sessão de quem o visita. config.validate recusa a
+			// combinação; isto protege políticas montadas de outra forma.
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		} else {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			if p.AllowCredentials {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+		}
+
+		if !preflight {
+			if len(p.ExposedHeaders) > 0 {
+				w.Header().Set("Access-Control-Expose-Headers", strings.Join(p.ExposedHeaders, ", "))
+			}
+			next(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Access-Control-Request-Method")
+		w.Header().Add("Vary", "Access-Control-Request-Headers")
+		if !p.methodAllowed(r.Header.Get("Access-Control-Request-Method")) {
+			rejectCORS(w, r, origin, "method_not_allowed")
+			return
+		}
+		if !p.headersAllowed(r.Header.Get("Access-Control-Request-Headers")) {
+			rejectCORS(w, r, origin, "header_not_allowed")
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Methods", strings.Join(p.AllowedMethods, ", "))
+		if len(p.AllowedHeaders) > 0 {
+			w.Header().Set("Access-Control-Allow-Headers", strings.Join(p.AllowedHeaders, ", "))
+		}
+		if p.MaxAge > 0 {
+			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(p.MaxAge.Seconds())))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func rejectCORS(w http.ResponseWriter, r *http.Request, origin, reason string) {
+	w.Header().Del("Access-Control-Allow-Origin")
+	w.Header().Del("Access-Control-Allow-Credentials")
+	slog.WarnContext(r.Context(), "Requisição CORS recusada",
+		"origin", origin,
+		"reason", reason,
+		"method", r.Method,
+		"request_method", r.Header.Get("Access-Control-Request-Method"),
+		"request_headers", r.Header.Get("Access-Control-Request-Headers"),
+	)
+	writeProblem(w, r, http.StatusForbidden, errorTypeCORS, "Origem não permitida")
+}
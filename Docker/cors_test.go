@@ -0,0 +1,123 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// setCORS troca a política global pelo resto do teste.
+func setCORS(t *testing.T, p corsPolicy) {
+	t.Helper()
+	old := corsCfg
+	t.Cleanup(func() { corsCfg = old })
+	corsCfg = p
+}
+
+func corsPolicyWith(origins []string, credentials bool) corsPolicy {
+	p := defaultCORSPolicy()
+	p.AllowedOrigins = origins
+	p.AllowCredentials = credentials
+	return p
+}
+
+func TestEnableCORS(t *testing.T) {
+	ok := enableCORS(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+
+	tests := []struct {
+		name        string
+		policy      corsPolicy
+		method      string
+		origin      string
+		reqMethod   string
+		reqHeaders  string
+		wantStatus  int
+		wantOrigin  string
+		wantCreds   bool
+		wantMethods bool
+	}{
+		{"sem Origin", corsPolicyWith(nil, false), http.MethodGet, "", "", "", http.StatusOK, "", false, false},
+		{"mesma origem", corsPolicyWith(nil, false), http.MethodGet, "http://api.exemplo.com", "", "", http.StatusOK, "", false, false},
+		{"origem não permitida", corsPolicyWith([]string{"https://app.exemplo.com"}, true), http.MethodGet, "https://mal.exemplo.net", "", "", http.StatusForbidden, "", false, false},
+		{"origem exata com credenciais", corsPolicyWith([]string{"https://app.exemplo.com"}, true), http.MethodGet, "https://app.exemplo.com", "", "", http.StatusOK, "https://app.exemplo.com", true, false},
+		{"curinga de subdomínio", corsPolicyWith([]string{"https://*.exemplo.com"}, false), http.MethodGet, "https://a.exemplo.com", "", "", http.StatusOK, "https://a.exemplo.com", false, false},
+		{"curinga não cobre o domínio raiz", corsPolicyWith([]string{"https://*.exemplo.com"}, false), http.MethodGet, "https://exemplo.com", "", "", http.StatusForbidden, "", false, false},
+		{"qualquer origem nunca com credenciais", corsPolicyWith([]string{"*"}, true), http.MethodGet, "https://a.exemplo.net", "", "", http.StatusOK, "*", false, false},
+		{"preflight", corsPolicyWith([]string{"https://app.exemplo.com"}, true), http.MethodOptions, "https://app.exemplo.com", http.MethodPatch, "Content-Type, If-Match", http.StatusNoContent, "https://app.exemplo.com", true, true},
+		{"preflight com método recusado", corsPolicyWith([]string{"https://app.exemplo.com"}, false), http.MethodOptions, "https://app.exemplo.com", "TRACE", "", http.StatusForbidden, "", false, false},
+		{"preflight com cabeçalho recusado", corsPolicyWith([]string{"https://app.exemplo.com"}, false), http.MethodOptions, "https://app.exemplo.com", http.MethodGet, "X-Outro", http.StatusForbidden, "", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setCORS(t, tt.policy)
+			req := httptest.NewRequest(tt.method, "http://api.exemplo.com/api/users", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.reqMethod != "" {
+				req.Header.Set("Access-Control-Request-Method", tt.reqMethod)
+			}
+			if tt.reqHeaders != "" {
+				req.Header.Set("Access-Control-Request-Headers", tt.reqHeaders)
+			}
+			rec := httptest.NewRecorder()
+			ok(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status %d, quer %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusForbidden {
+				if ct := rec.Header().Get("Content-Type"); ct != problemContentType {
+					t.Errorf("Content-Type %q, quer %q", ct, problemContentType)
+				}
+			}
+			h := rec.Header()
+			if got := h.Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("Access-Control-Allow-Origin %q, quer %q", got, tt.wantOrigin)
+			}
+			if got := h.Get("Access-Control-Allow-Credentials") == "true"; got != tt.wantCreds {
+				t.Errorf("Access-Control-Allow-Credentials %v, quer %v", got, tt.wantCreds)
+			}
+			if got := h.Get("Access-Control-Allow-Methods") != ""; got != tt.wantMethods {
+				t.Errorf("Access-Control-Allow-Methods presente %v, quer %v", got, tt.wantMethods)
+			}
+			if tt.wantMethods && h.Get("Access-Control-Max-Age") != "600" {
+				t.Errorf("Access-Control-Max-Age %q, quer 600", h.Get("Access-Control-Max-Age"))
+			}
+		})
+	}
+}
+
+func TestSameOrigin(t *testing.T) {
+	tests := []struct {
+		name           string
+		target         string
+		forwardedProto string
+		trustForwarded bool
+		origin         string
+		want           bool
+	}{
+		{"http igual", "http://api.exemplo.com/x", "", false, "http://api.exemplo.com", true},
+		{"porta padrão explícita", "http://api.exemplo.com/x", "", false, "http://api.exemplo.com:80", true},
+		{"outra porta", "http://api.exemplo.com:8080/x", "", false, "http://api.exemplo.com", false},
+		{"http contra TLS", "https://api.exemplo.com/x", "", false, "http://api.exemplo.com", false},
+		{"https com TLS", "https://api.exemplo.com/x", "", false, "https://api.exemplo.com", true},
+		{"X-Forwarded-Proto ignorado sem confiança", "http://api.exemplo.com/x", "https", false, "https://api.exemplo.com", false},
+		{"X-Forwarded-Proto confiável", "http://api.exemplo.com/x", "https", true, "https://api.exemplo.com", true},
+		{"X-Forwarded-Proto confiável recusa http", "http://api.exemplo.com/x", "https", true, "http://api.exemplo.com", false},
+		{"outro host", "http://api.exemplo.com/x", "", false, "http://app.exemplo.com", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Com um target https, httptest preenche req.TLS.
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.forwardedProto != "" {
+				req.Header.Set("X-Forwarded-Proto", tt.forwardedProto)
+			}
+			p := corsPolicy{TrustForwardedProto: tt.trustForwarded}
+			if got := p.sameOrigin(req, tt.origin); got != tt.want {
+				t.Errorf("sameOrigin(%q) = %v, quer %v", tt.origin, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"time"
+
+	"github.com/luc4s023/DesafioObservabilidade/internal/users"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// dbPingTimeout limita cada tentativa de conexão durante a espera pelo banco.
+const dbPingTimeout = 5 * time.Second
+
+var dbConnectAttemptsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: metricsNamespace,
+	Name:      "db_connect_attempts_total",
+	Help:      "Tentativas de conexão ao banco ao subir, por resultado (success ou a classe do erro).",
+}, []string{"result"})
+
+// openPostgres abre o pool com as credenciais de cfg.Postgres e espera o
+// banco ficar acessível (ver waitForDB). O connector é devolvido para a
+// renovação das conexões após a troca de credenciais.
+func openPostgres(ctx context.Context, cfg storeConfig) (*sql.DB, *users.PostgresConnector, error) {
+	connector := users.NewPostgresConnector(cfg.Postgres)
+	db := sql.OpenDB(connector)
+	configurePool(db, cfg)
+	if err := waitForDB(ctx, cfg, db.PingContext); err != nil {
+		db.Close()
+		return nil, nil, err
+	}
+	return db, connector, nil
+}
+
+// waitForDB chama ping até ele funcionar, com espera exponencial entre as
+// tentativas (de cfg.ConnectBackoffInitial até cfg.ConnectBackoffMax, com
+// jitter para que réplicas reiniciadas juntas não sincronizem) e no máximo
+// por cfg.ConnectTimeout. Assim o processo sobrevive ao banco subir depois
+// dele, como no Kubernetes, sem o depends_on do compose. Erros de
+// configuração (DSN inválido, ficheiro de segredo ausente) não são
+// repetidos; o cancelamento de ctx interrompe a espera.
+func waitForDB(ctx context.Context, cfg storeConfig, ping func(context.Context) error) error {
+	start := time.Now()
+	deadline := start.Add(cfg.ConnectTimeout)
+	backoff := cfg.ConnectBackoffInitial
+
+	for attempt := 1; ; attempt++ {
+		pingCtx, cancel := context.WithTimeout(ctx, dbPingTimeout)
+		err := ping(pingCtx)
+		cancel()
+		if err == nil {
+			dbConnectAttemptsTotal.WithLabelValues("success").Inc()
+			slog.InfoContext(ctx, "Banco de dados acessível", "attempt", attempt, "duration_ms", time.Since(start).Milliseconds())
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		class := users.PostgresErrorClass(err)
+		dbConnectAttemptsTotal.WithLabelValues(class).Inc()
+		if errors.Is(err, users.ErrPostgresConfig) {
+			return err
+		}
+
+		// Metade fixa e metade aleatória: a espera cresce, mas as réplicas
+		// se espalham.
+		wait := backoff/2 + rand.N(backoff/2+1)
+		if remaining := time.Until(deadline); wait > remaining {
+			if remaining <= 0 {
+				slog.ErrorContext(ctx, "Banco de dados inacessível", "attempt", attempt, "error_class", class, "error", err)
+				return fmt.Errorf("banco de dados inacessível após %d tentativas em %s: %v",
+					attempt, time.Since(start).Round(time.Millisecond), err)
+			}
+			wait = remaining
+		}
+		slog.WarnContext(ctx, "Banco de dados inacessível; nova tentativa", "attempt", attempt, "error_class", class,
+			"error", err, "retry_in", wait.Round(time.Millisecond).String())
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		backoff = min(backoff*2, cfg.ConnectBackoffMax)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"database/sql"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// configurePool aplica ao pool os limites de cfg; ver storeConfig.
+func configurePool(db *sql.DB, cfg storeConfig) {
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+}
+
+// poolStatser é implementado pelos stores sobre database/sql (Postgres e
+// SQLite).
+type poolStatser interface {
+	Stats() sql.DBStats
+}
+
+// dbStatsCollector exporta sql.DBStats a cada coleta, com o label backend.
+type dbStatsCollector struct {
+	stats func() sql.DBStats
+
+	maxOpen, open, inUse, idle                          *prometheus.Desc
+	waitCount, waitDuration                             *prometheus.Desc
+	maxIdleClosed, maxIdleTimeClosed, maxLifetimeClosed *prometheus.Desc
+}
+
+func newDBStatsCollector(backend string, stats func() sql.DBStats) *dbStatsCollector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(metricsNamespace, "db", name), help,
+			nil, prometheus.Labels{"backend": backend})
+	}
+	return &dbStatsCollector{
+		stats:             stats,
+		maxOpen:           desc("max_open_connections", "Limite de conexões abertas do pool (0 = ilimitado)."),
+		open:              desc("open_connections", "Conexões abertas, em uso ou ociosas."),
+		inUse:             desc("in_use_connections", "Conexões em uso."),
+		idle:              desc("idle_connections", "Conexões ociosas no pool."),
+		waitCount:         desc("wait_count_total", "Vezes em que uma requisição esperou por uma conexão livre."),
+		waitDuration:      desc("wait_duration_seconds_total", "Tempo total de espera por uma conexão livre, em segundos."),
+		maxIdleClosed:     desc("max_idle_closed_total", "Conexões fechadas por excederem o limite de conexões ociosas."),
+		maxIdleTimeClosed: desc("max_idle_time_closed_total", "Conexões fechadas por excederem o tempo máximo ociosas."),
+		maxLifetimeClosed: desc("max_lifetime_closed_total", "Conexões fechadas por excederem o tempo de vida máximo."),
+	}
+}
+
+func (c *dbStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(c, ch)
+}
+
+func (c *dbStatsCollector) Collect(ch chan<- prometheus.Metric) {
+	s := c.stats()
+	gauge := func(d *prometheus.Desc, v float64) {
+		ch <- prometheus.MustNewConstMetric(d, prometheus.GaugeValue, v)
+	}
+	counter := func(d *prometheus.Desc, v float64) {
+		ch <- prometheus.MustNewConstMetric(d, prometheus.CounterValue, v)
+	}
+	gauge(c.maxOpen, float64(s.MaxOpenConnections))
+	gauge(c.open, float64(s.OpenConnections))
+	gauge(c.inUse, float64(s.InUse))
+	gauge(c.idle, float64(s.Idle))
+	counter(c.waitCount, float64(s.WaitCount))
+	counter(c.waitDuration, s.WaitDuration.Seconds())
+	counter(c.maxIdleClosed, float64(s.MaxIdleClosed))
+	counter(c.maxIdleTimeClosed, float64(s.MaxIdleTimeClosed))
+	counter(c.maxLifetimeClosed, float64(s.MaxLifetimeClosed))
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/luc4s023/DesafioObservabilidade/internal/users"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Códigos de erro estáveis da API. São o campo "code" das respostas
+// problem+json e o label error_type das métricas; clientes devem decidir por
+// eles, nunca pela mensagem.
+const (
+	errorTypeValidation            = "validation"
+	errorTypeUsernameTaken         = "username_taken"
+	errorTypeEmailTaken            = "email_taken"
+	errorTypeNotFound              = "not_found"
+	errorTypeInvalidCredentials    = "invalid_credentials"
+	errorTypeBadRequest            = "bad_request"
+	errorTypeUnauthenticated       = "unauthenticated"
+	errorTypeForbidden             = "forbidden"
+	errorTypeCORS                  = "cors_rejected"
+	errorTypeMethodNotAllowed      = "method_not_allowed"
+	errorTypePreconditionFailed    = "precondition_failed"
+	errorTypePreconditionRequired  = "precondition_required"
+	errorTypePayloadTooLarge       = "payload_too_large"
+	errorTypeIdempotencyMismatch   = "idempotency_key_reused"
+	errorTypeIdempotencyInProgress = "idempotency_in_progress"
+	errorTypeUnavailable           = "unavailable"
+	errorTypeInternal              = "internal"
+	// errorTypeOther marca as respostas 4xx sem tipo definido (ex.: 404 do ServeMux).
+	errorTypeOther = "other"
+)
+
+var problemTitles = map[string]string{
+	errorTypeValidation:            "Dados inválidos",
+	errorTypeUsernameTaken:         "Nome de utilizador já existe",
+	errorTypeEmailTaken:            "Email já registado",
+	errorTypeNotFound:              "Recurso não encontrado",
+	errorTypeInvalidCredentials:    "Credenciais inválidas",
+	errorTypeBadRequest:            "Requisição inválida",
+	errorTypeUnauthenticated:       "Não autenticado",
+	errorTypeForbidden:             "Acesso negado",
+	errorTypeCORS:                  "Origem não permitida",
+	errorTypeMethodNotAllowed:      "Método não permitido",
+	errorTypePreconditionFailed:    "Versão desatualizada",
+	errorTypePreconditionRequired:  "If-Match obrigatório",
+	errorTypePayloadTooLarge:       "Requisição demasiado grande",
+	errorTypeIdempotencyMismatch:   "Idempotency-Key reutilizada",
+	errorTypeIdempotencyInProgress: "Requisição em andamento",
+	errorTypeUnavailable:           "Serviço indisponível",
+	errorTypeInternal:              "Erro interno",
+}
+
+const (
+	problemContentType = "application/problem+json"
+	problemTypePrefix  = "urn:usuarios:problem:"
+)
+
+// problem é o corpo de erro da API no formato RFC 7807, acrescido do código
+// estável, do request ID e dos erros por campo.
+type problem struct {
+	Type      string             `json:"type"`
+	Title     string             `json:"title"`
+	Status    int                `json:"status"`
+	Detail    string             `json:"detail,omitempty"`
+	Instance  string             `json:"instance,omitempty"`
+	Code      string             `json:"code"`
+	RequestID string             `json:"request_id,omitempty"`
+	Errors    []users.FieldError `json:"errors,omitempty"`
+}
+
+var httpErrorResponsesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: metricsNamespace,
+	Name:      "http_error_responses_total",
+	Help:      "Respostas de erro (4xx e 5xx) da API, por rota, status e tipo de erro.",
+}, []string{"route", "code", "error_type"})
+
+// classifyError traduz os erros do domínio no status HTTP e no error_type.
+// Qualquer erro não reconhecido é um erro interno.
+func classifyError(err error) (status int, errorType string) {
+	switch {
+	case errors.Is(err, users.ErrValidation):
+		return http.StatusBadRequest, errorTypeValidation
+	case errors.Is(err, users.ErrUsernameTaken):
+		return http.StatusConflict, errorTypeUsernameTaken
+	case errors.Is(err, users.ErrEmailTaken):
+		return http.StatusConflict, errorTypeEmailTaken
+	case errors.Is(err, users.ErrNotFound):
+		return http.StatusNotFound, errorTypeNotFound
+	case errors.Is(err, users.ErrVersionConflict):
+		return http.StatusPreconditionFailed, errorTypePreconditionFailed
+	case errors.Is(err, users.ErrInvalidCredentials):
+		return http.StatusUnauthorized, errorTypeInvalidCredentials
+	default:
+		return http.StatusInternalServerError, errorTypeInternal
+	}
+}
+
+// writeError responde um erro do domínio com o status de classifyError. Nos
+// erros internos o detalhe é apenas internalMsg; o erro original, que pode
+// conter SQL ou mensagens do driver, vai só para o log.
+func writeError(w http.ResponseWriter, r *http.Request, err error, internalMsg string) {
+	status, errorType := classifyError(err)
+	if status >= http.StatusInternalServerError {
+		slog.ErrorContext(r.Context(), internalMsg, "error", err)
+		writeProblem(w, r, status, errorType, internalMsg)
+		return
+	}
+
+	var fields []users.FieldError
+	var verr *users.ValidationError
+	if errors.As(err, &verr) {
+		fields = verr.Fields
+	}
+	writeProblemFields(w, r, status, errorType, err.Error(), fields)
+}
+
+func writeProblem(w http.ResponseWriter, r *http.Request, status int, errorType, detail string) {
+	writeProblemFields(w, r, status, errorType, detail, nil)
+}
+
+// writeProblemFields responde application/problem+json e marca o error_type
+// da resposta para as métricas.
+func writeProblemFields(w http.ResponseWriter, r *http.Request, status int, errorType, detail string, fields []users.FieldError) {
+	setErrorType(w, errorType)
+
+	title, ok := problemTitles[errorType]
+	if !ok {
+		title = http.StatusText(status)
+	}
+	w.Header().Set("Content-Type", problemContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(problem{
+		Type:      problemTypePrefix + errorType,
+		Title:     title,
+		Status:    status,
+		Detail:    detail,
+		Instance:  r.URL.Path,
+		Code:      errorType,
+		RequestID: requestIDFromContext(r.Context()),
+		Errors:    fields,
+	})
+}
+
+// setErrorType guarda o error_type no statusRecorder de instrumentHandler,
+// atravessando os ResponseWriters que o envolvem.
+func setErrorType(w http.ResponseWriter, errorType string) {
+	for {
+		switch rw := w.(type) {
+		case *statusRecorder:
+			rw.errorType = errorType
+			return
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = rw.Unwrap()
+		default:
+			return
+		}
+	}
+}
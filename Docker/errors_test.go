@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/luc4s023/DesafioObservabilidade/internal/users"
+)
+
+func TestWriteError(t *testing.T) {
+	validation := &users.ValidationError{Fields: []users.FieldError{{Field: "email", Message: "email inválido"}}}
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantCode   string
+		wantFields int
+	}{
+		{"validação", validation, http.StatusBadRequest, errorTypeValidation, 1},
+		{"username em uso", fmt.Errorf("%w: 'ana'", users.ErrUsernameTaken), http.StatusConflict, errorTypeUsernameTaken, 0},
+		{"email em uso", fmt.Errorf("%w: 'ana@exemplo.com'", users.ErrEmailTaken), http.StatusConflict, errorTypeEmailTaken, 0},
+		{"não encontrado", users.ErrNotFound, http.StatusNotFound, errorTypeNotFound, 0},
+		{"versão desatualizada", users.ErrVersionConflict, http.StatusPreconditionFailed, errorTypePreconditionFailed, 0},
+		{"credenciais", users.ErrInvalidCredentials, http.StatusUnauthorized, errorTypeInvalidCredentials, 0},
+		{"interno", errors.New(`pq: relation "users" does not exist`), http.StatusInternalServerError, errorTypeInternal, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/users/7", nil)
+			rec := httptest.NewRecorder()
+			writeError(rec, req, tt.err, "Erro ao buscar utilizador")
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status %d, quer %d", rec.Code, tt.wantStatus)
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != problemContentType {
+				t.Errorf("Content-Type %q, quer %q", ct, problemContentType)
+			}
+			var p problem
+			if err := json.NewDecoder(rec.Body).Decode(&p); err != nil {
+				t.Fatalf("corpo inválido: %v", err)
+			}
+			if p.Code != tt.wantCode || p.Type != problemTypePrefix+tt.wantCode || p.Status != tt.wantStatus ||
+				p.Title != problemTitles[tt.wantCode] || p.Instance != "/api/users/7" {
+				t.Errorf("problem %+v, quer code %q", p, tt.wantCode)
+			}
+			if len(p.Errors) != tt.wantFields {
+				t.Errorf("errors %+v, quer %d campos", p.Errors, tt.wantFields)
+			}
+			// O erro original dos erros internos fica só no log.
+			if tt.wantStatus == http.StatusInternalServerError && (strings.Contains(p.Detail, "pq:") || p.Detail != "Erro ao buscar utilizador") {
+				t.Errorf("detail %q expõe o erro interno", p.Detail)
+			}
+		})
+	}
+}
+
+func TestProblemCarriesRequestID(t *testing.T) {
+	h := apiRoute("/api/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		writeProblem(w, r, http.StatusNotFound, errorTypeNotFound, "Utilizador não encontrado")
+	})
+	req := httptest.NewRequest(http.MethodGet, "/api/users/7", nil)
+	req.Header.Set(requestIDHeader, "req-123")
+	rec := httptest.NewRecorder()
+	h(rec, req)
+
+	var p problem
+	if err := json.NewDecoder(rec.Body).Decode(&p); err != nil {
+		t.Fatalf("corpo inválido: %v", err)
+	}
+	if p.RequestID != "req-123" || rec.Header().Get(requestIDHeader) != "req-123" {
+		t.Errorf("request_id %q e cabeçalho %q, quer req-123", p.RequestID, rec.Header().Get(requestIDHeader))
+	}
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	h := apiRoute("/api/auth/login", methodNotAllowed("POST"))
+	rec := httptest.NewRecorder()
+	h(rec, httptest.NewRequest(http.MethodGet, "/api/auth/login", nil))
+
+	if got := rec.Header().Get("Allow"); got != "POST" {
+		t.Errorf("Allow %q, quer %q", got, "POST")
+	}
+	checkProblem(t, rec, http.StatusMethodNotAllowed, errorTypeMethodNotAllowed)
+}
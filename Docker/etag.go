@@ -0,0 +1,98 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/luc4s023/DesafioObservabilidade/internal/users"
+)
+
+// userETag identifica uma versão de um utilizador: "<id>.<versão>".
+func userETag(u users.User) string {
+	return fmt.Sprintf(`"%d.%d"`, u.ID, u.Version)
+}
+
+// contentETag é um ETag fraco derivado do corpo, para respostas sem versão
+// própria (listas e buscas).
+func contentETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `W/"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// writeCachedJSON responde v com o ETag indicado (ou contentETag, se vazio) e
+// devolve 304 sem corpo quando o If-None-Match da requisição já o contém.
+func writeCachedJSON(w http.ResponseWriter, r *http.Request, v any, etag string) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		writeError(w, r, err, "Erro ao serializar resposta")
+		return
+	}
+	if etag == "" {
+		etag = contentETag(body)
+	}
+
+	w.Header().Set("ETag", etag)
+	// O cliente pode guardar a resposta, mas deve revalidá-la a cada uso.
+	w.Header().Set("Cache-Control", "private, no-cache")
+	if etagListContains(r.Header.Get("If-None-Match"), etag, false) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(append(body, '\n'))
+}
+
+// etagListContains indica se o valor de If-Match/If-None-Match contém etag ou
+// "*". Com strong, ETags fracos nunca coincidem (comparação forte da RFC 9110).
+func etagListContains(header, etag string, strong bool) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return true
+		}
+		if strong {
+			if !strings.HasPrefix(tag, "W/") && tag == etag {
+				return true
+			}
+			continue
+		}
+		if strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// ifMatchVersion lê do If-Match a versão esperada do utilizador id. Sem o
+// cabeçalho responde 428; com um ETag de outro utilizador ou ilegível, 412.
+// "*" devolve a versão 0, que dispensa a verificação.
+func ifMatchVersion(w http.ResponseWriter, r *http.Request, id int64) (int64, bool) {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		writeProblem(w, r, http.StatusPreconditionRequired, errorTypePreconditionRequired,
+			"Cabeçalho If-Match obrigatório; use o ETag devolvido por GET /api/users/{id}")
+		return 0, false
+	}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return 0, true
+		}
+		tagID, version, ok := strings.Cut(strings.Trim(tag, `"`), ".")
+		if !ok || strings.HasPrefix(tag, "W/") || tagID != strconv.FormatInt(id, 10) {
+			continue
+		}
+		if v, err := strconv.ParseInt(version, 10, 64); err == nil && v > 0 {
+			return v, true
+		}
+	}
+	writeProblem(w, r, http.StatusPreconditionFailed, errorTypePreconditionFailed,
+		"If-Match não corresponde a nenhuma versão do utilizador")
+	return 0, false
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/luc4s023/DesafioObservabilidade/internal/users"
+)
+
+func TestUserETagPreconditions(t *testing.T) {
+	s := newTestServer(t)
+	ana := mustRegister(t, s, "ana", users.RoleAdmin)
+	token := loginToken(t, s, "ana").AccessToken
+	target := "/api/users/" + strconv.FormatInt(ana.ID, 10)
+
+	get := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		req := bearer(httptest.NewRequest(http.MethodGet, target, nil), token)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		return serve("GET /api/users/{id}", s.requireAuth(s.getUserHandler), req)
+	}
+	patch := func(ifMatch, body string) *httptest.ResponseRecorder {
+		req := bearer(jsonRequest(http.MethodPatch, target, body), token)
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		return serve("PATCH /api/users/{id}", s.requireAuth(s.updateUserHandler), req)
+	}
+
+	rec := get("")
+	etag := rec.Header().Get("ETag")
+	if rec.Code != http.StatusOK || etag != userETag(ana) {
+		t.Fatalf("GET: status %d, ETag %q, quer 200 e %q", rec.Code, etag, userETag(ana))
+	}
+	if rec := get(etag); rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Errorf("If-None-Match atual: status %d com %d bytes, quer 304 sem corpo", rec.Code, rec.Body.Len())
+	}
+	if rec := get(`"999.1"`); rec.Code != http.StatusOK {
+		t.Errorf("If-None-Match de outro ETag: status %d, quer 200", rec.Code)
+	}
+
+	checkProblem(t, patch("", `{"email":"ana2@exemplo.com"}`), http.StatusPreconditionRequired, errorTypePreconditionRequired)
+	checkProblem(t, patch(`"999.1"`, `{"email":"ana2@exemplo.com"}`), http.StatusPreconditionFailed, errorTypePreconditionFailed)
+	checkProblem(t, patch("W/"+etag, `{"email":"ana2@exemplo.com"}`), http.StatusPreconditionFailed, errorTypePreconditionFailed)
+
+	rec = patch(etag, `{"email":"ana2@exemplo.com"}`)
+	if rec.Code != http.StatusOK || rec.Header().Get("ETag") == etag {
+		t.Fatalf("PATCH: status %d, ETag %q, quer 200 e um ETag novo (%s)", rec.Code, rec.Header().Get("ETag"), rec.Body)
+	}
+	// O ETag antigo já não corresponde à versão gravada.
+	checkProblem(t, patch(etag, `{"email":"ana3@exemplo.com"}`), http.StatusPreconditionFailed, errorTypePreconditionFailed)
+	if rec := get(etag); rec.Code != http.StatusOK {
+		t.Errorf("If-None-Match antigo: status %d, quer 200", rec.Code)
+	}
+}
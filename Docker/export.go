@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/luc4s023/DesafioObservabilidade/internal/users"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	usersExportRowsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "users_export_rows_total",
+		Help:      "Utilizadores enviados por GET /api/users/export, por formato.",
+	}, []string{"format"})
+
+	usersExportDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "users_export_duration_seconds",
+		Help:      "Duração das exportações de utilizadores, por formato e resultado (ok, error).",
+		Buckets:   []float64{0.1, 0.5, 1, 5, 15, 60, 300, 900},
+	}, []string{"format", "result"})
+)
+
+const (
+	// exportFlushRows é o número de linhas acumuladas antes de cada Flush.
+	exportFlushRows = 500
+	// exportWriteDeadline renova, a cada Flush, o prazo de escrita do
+	// servidor (HTTP_WRITE_TIMEOUT), que não comportaria uma exportação longa.
+	exportWriteDeadline = 30 * time.Second
+)
+
+// exportColumn é uma coluna da exportação e como obtê-la de um utilizador.
+type exportColumn struct {
+	name  string
+	value func(users.User) any
+}
+
+// exportColumns são as colunas que a exportação pode incluir, na ordem
+// padrão. O hash da senha não está entre elas.
+var exportColumns = []exportColumn{
+	{"id", func(u users.User) any { return u.ID }},
+	{"username", func(u users.User) any { return u.Username }},
+	{"email", func(u users.User) any { return u.Email }},
+	{"role", func(u users.User) any { return u.Role }},
+	{"status", func(u users.User) any { return u.Status }},
+	{"version", func(u users.User) any { return u.Version }},
+	{"created_at", func(u users.User) any { return u.CreatedAt }},
+	{"updated_at", func(u users.User) any { return u.UpdatedAt }},
+}
+
+// parseExportColumns lê ?columns=id,email,...; sem o parâmetro exporta todas.
+func parseExportColumns(v string) ([]exportColumn, error) {
+	if v == "" {
+		return exportColumns, nil
+	}
+	var cols []exportColumn
+	seen := map[string]bool{}
+	for _, name := range splitList(v) {
+		i := slices.IndexFunc(exportColumns, func(c exportColumn) bool { return c.name == name })
+		if i < 0 || seen[name] {
+			return nil, &users.ValidationError{Fields: []users.FieldError{{
+				Field:   "columns",
+				Message: "coluna inválida ou repetida: " + name,
+			}}}
+		}
+		seen[name] = true
+		cols = append(cols, exportColumns[i])
+	}
+	return cols, nil
+}
+
+// exportWriter grava um utilizador no formato escolhido.
+type exportWriter interface {
+	writeHeader() error
+	writeUser(u users.User) error
+	// flush esvazia o buffer do formato para o ResponseWriter.
+	flush() error
+}
+
+type ndjsonExport struct {
+	w    http.ResponseWriter
+	cols []exportColumn
+	buf  bytes.Buffer
+}
+
+func (e *ndjsonExport) writeHeader() error { return nil }
+
+// writeUser monta o objeto à mão para manter a ordem das colunas pedida.
+func (e *ndjsonExport) writeUser(u users.User) error {
+	e.buf.WriteByte('{')
+	for i, c := range e.cols {
+		if i > 0 {
+			e.buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(c.name)
+		val, err := json.Marshal(c.value(u))
+		if err != nil {
+			return err
+		}
+		e.buf.Write(key)
+		e.buf.WriteByte(':')
+		e.buf.Write(val)
+	}
+	e.buf.WriteString("}\n")
+	return nil
+}
+
+func (e *ndjsonExport) flush() error {
+	_, err := e.w.Write(e.buf.Bytes())
+	e.buf.Reset()
+	return err
+}
+
+type csvExport struct {
+	cw   *csv.Writer
+	cols []exportColumn
+}
+
+func (e *csvExport) writeHeader() error {
+	names := make([]string, len(e.cols))
+	for i, c := range e.cols {
+		names[i] = c.name
+	}
+	return e.cw.Write(names)
+}
+
+func (e *csvExport) writeUser(u users.User) error {
+	record := make([]string, len(e.cols))
+	for i, c := range e.cols {
+		switch v := c.value(u).(type) {
+		case string:
+			record[i] = v
+		case int64:
+			record[i] = strconv.FormatInt(v, 10)
+		case time.Time:
+			record[i] = v.UTC().Format(time.RFC3339Nano)
+		}
+	}
+	return e.cw.Write(record)
+}
+
+func (e *csvExport) flush() error {
+	e.cw.Flush()
+	return e.cw.Error()
+}
+
+// exportUsersHandler transmite os utilizadores filtrados (mesmos parâmetros de
+// GET /api/users, sem limite de página) em NDJSON ou CSV, lendo-os do cursor
+// do banco (no SQLite, em páginas; ver Store.Each) e enviando-os em blocos,
+// com memória constante.
+func (s *server) exportUsersHandler(w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+	format := values.Get("format")
+	if format == "" {
+		format = "ndjson"
+	}
+	if format != "ndjson" && format != "csv" {
+		writeError(w, r, &users.ValidationError{Fields: []users.FieldError{{
+			Field: "format", Message: "formato inválido; use ndjson ou csv",
+		}}}, "Erro ao exportar utilizadores")
+		return
+	}
+	cols, err := parseExportColumns(values.Get("columns"))
+	if err != nil {
+		writeError(w, r, err, "Erro ao exportar utilizadores")
+		return
+	}
+	q, err := parseListQuery(values, 0, 0)
+	if err != nil {
+		writeError(w, r, err, "Erro ao exportar utilizadores")
+		return
+	}
+
+	var out exportWriter
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		out = &csvExport{cw: csv.NewWriter(w), cols: cols}
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		out = &ndjsonExport{w: w, cols: cols}
+	}
+	w.Header().Set("Content-Disposition", `attachment; filename="users.`+format+`"`)
+	w.Header().Set("Cache-Control", "no-store")
+
+	ctx := r.Context()
+	rc := http.NewResponseController(w)
+	start := time.Now()
+	var rows int64
+	started := false
+	flush := func() error {
+		if err := out.flush(); err != nil {
+			return err
+		}
+		rc.SetWriteDeadline(time.Now().Add(exportWriteDeadline))
+		return rc.Flush()
+	}
+
+	err = s.svc.EachUser(ctx, q, func(u users.User) error {
+		if !started {
+			started = true
+			if err := out.writeHeader(); err != nil {
+				return err
+			}
+		}
+		if err := out.writeUser(u); err != nil {
+			return err
+		}
+		rows++
+		usersExportRowsTotal.WithLabelValues(format).Inc()
+		if rows%exportFlushRows == 0 {
+			return flush()
+		}
+		return nil
+	})
+	if err == nil && !started {
+		err = out.writeHeader()
+	}
+	if err == nil {
+		err = flush()
+	}
+
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	usersExportDuration.WithLabelValues(format, result).Observe(time.Since(start).Seconds())
+
+	switch {
+	case err == nil:
+		slog.InfoContext(ctx, "Exportação de utilizadores concluída", "audit", true,
+			"format", format, "columns", len(cols), "rows", rows)
+	case !started:
+		// Nada foi enviado ainda: o cliente recebe um problem+json normal.
+		w.Header().Del("Content-Disposition")
+		writeError(w, r, err, "Erro ao exportar utilizadores")
+	default:
+		// O status 200 já foi enviado; o corpo fica truncado e o erro só vai para o log.
+		slog.ErrorContext(ctx, "Exportação de utilizadores interrompida", "error", err,
+			"format", format, "rows", rows)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const healthCheckTimeout = 2 * time.Second
+
+// Estado do processo consultado pelas sondas do orquestrador.
+var (
+	startupComplete atomic.Bool
+	shuttingDown    atomic.Bool
+)
+
+// processStart aproxima o início do processo, para medir o tempo até ficar
+// pronto.
+var processStart = time.Now()
+
+var startupTimeToReady = promauto.NewGauge(prometheus.GaugeOpts{
+	Namespace: metricsNamespace,
+	Name:      "startup_time_to_ready_seconds",
+	Help:      "Tempo entre o início do processo e o fim da inicialização (banco acessível e rotas registadas).",
+})
+
+// markStartupComplete faz /startupz e /readyz passarem a responder pelo
+// estado real do servidor e regista o tempo até aqui.
+func markStartupComplete() {
+	elapsed := time.Since(processStart)
+	startupTimeToReady.Set(elapsed.Seconds())
+	startupComplete.Store(true)
+	slog.Info("Inicialização concluída", "time_to_ready_ms", elapsed.Milliseconds())
+}
+
+// whenStarted responde 503 com Retry-After até a inicialização terminar, em
+// vez de deixar a rota cair no site estático com um 404. Os campos de server
+// só são preenchidos antes de markStartupComplete, e a leitura de
+// startupComplete garante que next os vê.
+func whenStarted(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !startupComplete.Load() {
+			w.Header().Set("Retry-After", "5")
+			writeProblem(w, r, http.StatusServiceUnavailable, errorTypeUnavailable, "O serviço ainda está a iniciar")
+			return
+		}
+		next(w, r)
+	}
+}
+
+type dependencyStatus struct {
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+type healthResponse struct {
+	Status string                      `json:"status"`
+	Checks map[string]dependencyStatus `json:"checks,omitempty"`
+}
+
+// healthzHandler é a sonda de liveness: responde 200 enquanto o processo
+// consegue atender requisições, sem consultar dependências.
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, http.StatusOK, healthResponse{Status: "ok"})
+}
+
+// startupzHandler responde 503 até a inicialização (conexão ao banco e
+// preparação do schema) terminar.
+func startupzHandler(w http.ResponseWriter, r *http.Request) {
+	if !startupComplete.Load() {
+		writeHealth(w, http.StatusServiceUnavailable, healthResponse{Status: "starting"})
+		return
+	}
+	writeHealth(w, http.StatusOK, healthResponse{Status: "started"})
+}
+
+// readyzHandler verifica as dependências necessárias para atender tráfego e
+// responde 503 se alguma falhar ou se o servidor estiver a encerrar.
+func (s *server) readyzHandler(w http.ResponseWriter, r *http.Request) {
+	if shuttingDown.Load() {
+		writeHealth(w, http.StatusServiceUnavailable, healthResponse{Status: "shutting_down"})
+		return
+	}
+	if !startupComplete.Load() {
+		writeHealth(w, http.StatusServiceUnavailable, healthResponse{Status: "starting"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+	defer cancel()
+
+	resp := healthResponse{
+		Status: "ready",
+		Checks: map[string]dependencyStatus{
+			s.store.Backend(): runCheck(ctx, s.store.Ping),
+			"users_table":     runCheck(ctx, s.store.CheckSchema),
+		},
+	}
+
+	status := http.StatusOK
+	for name, check := range resp.Checks {
+		if check.Status != "up" {
+			resp.Status = "not_ready"
+			status = http.StatusServiceUnavailable
+			slog.WarnContext(ctx, "Dependência indisponível na verificação de readiness", "dependency", name, "error", check.Error)
+		}
+	}
+	writeHealth(w, status, resp)
+}
+
+func runCheck(ctx context.Context, check func(context.Context) error) dependencyStatus {
+	start := time.Now()
+	err := check(ctx)
+	ds := dependencyStatus{
+		Status:    "up",
+		LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		ds.Status = "down"
+		ds.Error = err.Error()
+	}
+	return ds
+}
+
+func writeHealth(w http.ResponseWriter, status int, resp healthResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
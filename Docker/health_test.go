@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRoutesWaitForStartup(t *testing.T) {
+	s := newTestServer(t)
+	old := startupComplete.Load()
+	t.Cleanup(func() { startupComplete.Store(old) })
+	startupComplete.Store(false)
+
+	calls := 0
+	api := whenStarted(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusOK)
+	})
+	probe := func(h http.HandlerFunc) int {
+		rec := httptest.NewRecorder()
+		h(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rec.Code
+	}
+
+	rec := serve("GET /api/users", api, httptest.NewRequest(http.MethodGet, "/api/users", nil))
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("503 sem Retry-After")
+	}
+	checkProblem(t, rec, http.StatusServiceUnavailable, errorTypeUnavailable)
+	if calls != 0 {
+		t.Errorf("handler chamado %d vezes antes do fim da inicialização", calls)
+	}
+	if got := probe(startupzHandler); got != http.StatusServiceUnavailable {
+		t.Errorf("/startupz antes da inicialização: %d, quer 503", got)
+	}
+	if got := probe(s.readyzHandler); got != http.StatusServiceUnavailable {
+		t.Errorf("/readyz antes da inicialização: %d, quer 503", got)
+	}
+
+	markStartupComplete()
+	if rec := serve("GET /api/users", api, httptest.NewRequest(http.MethodGet, "/api/users", nil)); rec.Code != http.StatusOK || calls != 1 {
+		t.Errorf("depois da inicialização: status %d com %d chamadas, quer 200 e 1", rec.Code, calls)
+	}
+	if got := probe(startupzHandler); got != http.StatusOK {
+		t.Errorf("/startupz depois da inicialização: %d, quer 200", got)
+	}
+	if got := probe(s.readyzHandler); got != http.StatusOK {
+		t.Errorf("/readyz depois da inicialização: %d, quer 200", got)
+	}
+}
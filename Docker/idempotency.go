@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/luc4s023/DesafioObservabilidade/internal/users"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	idempotencyKeyHeader     = "Idempotency-Key"
+	idempotentReplayedHeader = "Idempotent-Replayed"
+	maxIdempotencyKeyLen     = 255
+	// maxIdempotentBodyBytes limita o corpo lido para calcular a impressão digital.
+	maxIdempotentBodyBytes = 1 << 20
+)
+
+// idempotencyConfig controla por quanto tempo as respostas ficam guardadas.
+type idempotencyConfig struct {
+	// TTL é o tempo em que uma resposta guardada é repetida.
+	TTL time.Duration
+	// LockTimeout é o tempo máximo em que uma requisição em andamento retém a
+	// chave; depois dele (ex.: se a instância caiu) outra tentativa a assume.
+	LockTimeout time.Duration
+	// PurgeInterval é o intervalo entre remoções dos registos expirados.
+	PurgeInterval time.Duration
+}
+
+var idempotencyCfg = defaultIdempotencyConfig()
+
+func defaultIdempotencyConfig() idempotencyConfig {
+	return idempotencyConfig{TTL: 24 * time.Hour, LockTimeout: time.Minute, PurgeInterval: time.Hour}
+}
+
+var idempotencyRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: metricsNamespace,
+	Name:      "idempotency_requests_total",
+	Help:      "Requisições com Idempotency-Key, por rota e resultado (stored, replayed, mismatch, in_progress, released).",
+}, []string{"route", "result"})
+
+// requestFingerprint resume método, caminho e corpo. Corpos JSON são
+// normalizados (ordem das chaves, espaços) para que só o conteúdo conte. O
+// corpo do registo contém a senha em claro, então o resumo é um HMAC com uma
+// chave derivada do segredo do servidor: guardado no banco, um SHA-256 simples
+// poderia ser atacado offline como um hash da senha.
+func requestFingerprint(r *http.Request, body []byte) string {
+	var v any
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err == nil && !dec.More() {
+		if canonical, err := json.Marshal(v); err == nil {
+			body = canonical
+		}
+	}
+	h := hmac.New(sha256.New, fingerprintKey())
+	fmt.Fprintf(h, "%s %s\n", r.Method, r.URL.Path)
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// fingerprintKey deriva de AUTH_JWT_SECRET a chave das impressões digitais,
+// para não usar o mesmo segredo em dois fins. Todas as réplicas partilham o
+// segredo e, portanto, a chave.
+func fingerprintKey() []byte {
+	mac := hmac.New(sha256.New, authCfg.JWTSecret)
+	mac.Write([]byte("idempotency-fingerprint"))
+	return mac.Sum(nil)
+}
+
+// responseCapture repassa a resposta ao cliente e guarda uma cópia dela.
+type responseCapture struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (c *responseCapture) WriteHeader(status int) {
+	if c.status == 0 {
+		c.status = status
+	}
+	c.ResponseWriter.WriteHeader(status)
+}
+
+func (c *responseCapture) Write(b []byte) (int, error) {
+	if c.status == 0 {
+		c.status = http.StatusOK
+	}
+	c.body.Write(b)
+	return c.ResponseWriter.Write(b)
+}
+
+func (c *responseCapture) Unwrap() http.ResponseWriter { return c.ResponseWriter }
+
+// idempotent torna route seguro para repetições: a primeira requisição com
+// um Idempotency-Key é executada e a sua resposta guardada por
+// idempotencyCfg.TTL; as seguintes com a mesma chave e o mesmo corpo recebem
+// essa resposta com Idempotent-Replayed: true, sem executar next. A mesma
+// chave com outro corpo recebe 422 e, enquanto a primeira não termina, 409.
+// Respostas 5xx não são guardadas, para que o cliente possa tentar de novo.
+// Sem o cabeçalho, next é chamado diretamente.
+func (s *server) idempotent(route string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(idempotencyKeyHeader)
+		if key == "" {
+			next(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLen {
+			writeProblem(w, r, http.StatusBadRequest, errorTypeBadRequest,
+				fmt.Sprintf("%s deve ter no máximo %d caracteres", idempotencyKeyHeader, maxIdempotencyKeyLen))
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIdempotentBodyBytes))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				writeProblem(w, r, http.StatusRequestEntityTooLarge, errorTypePayloadTooLarge, "Corpo da requisição demasiado grande")
+				return
+			}
+			writeProblem(w, r, http.StatusBadRequest, errorTypeBadRequest, "Erro ao ler o corpo da requisição")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		ctx := r.Context()
+		now := time.Now()
+		rec := users.IdempotencyRecord{
+			// A chave vale por rota: a mesma chave noutro endpoint é outra operação.
+			Key:         r.Method + " " + route + " " + key,
+			Fingerprint: requestFingerprint(r, body),
+			ExpiresAt:   now.Add(idempotencyCfg.LockTimeout),
+		}
+		existing, reserved, err := s.store.ReserveIdempotencyKey(ctx, rec, now)
+		if err != nil {
+			writeError(w, r, err, "Erro ao verificar Idempotency-Key")
+			return
+		}
+		if !reserved {
+			switch {
+			case existing.Fingerprint != rec.Fingerprint:
+				idempotencyRequestsTotal.WithLabelValues(route, "mismatch").Inc()
+				writeProblem(w, r, http.StatusUnprocessableEntity, errorTypeIdempotencyMismatch,
+					"Idempotency-Key já usada com outro corpo de requisição")
+			case existing.Status == 0:
+				idempotencyRequestsTotal.WithLabelValues(route, "in_progress").Inc()
+				w.Header().Set("Retry-After", "1")
+				writeProblem(w, r, http.StatusConflict, errorTypeIdempotencyInProgress,
+					"Uma requisição com esta Idempotency-Key ainda está em andamento")
+			default:
+				idempotencyRequestsTotal.WithLabelValues(route, "replayed").Inc()
+				slog.InfoContext(ctx, "Resposta idempotente repetida", "status", existing.Status)
+				if existing.ContentType != "" {
+					w.Header().Set("Content-Type", existing.ContentType)
+				}
+				w.Header().Set(idempotentReplayedHeader, "true")
+				w.WriteHeader(existing.Status)
+				w.Write(existing.Body)
+			}
+			return
+		}
+
+		capture := &responseCapture{ResponseWriter: w}
+		next(capture, r)
+
+		// A resposta já foi enviada; um cancelamento do cliente não deve
+		// impedir que ela seja guardada.
+		ctx = context.WithoutCancel(ctx)
+		if capture.status == 0 || capture.status >= http.StatusInternalServerError {
+			idempotencyRequestsTotal.WithLabelValues(route, "released").Inc()
+			if err := s.store.DeleteIdempotencyKey(ctx, rec.Key); err != nil {
+				slog.WarnContext(ctx, "Falha ao liberar Idempotency-Key", "error", err)
+			}
+			return
+		}
+		rec.Status = capture.status
+		rec.ContentType = capture.Header().Get("Content-Type")
+		rec.Body = capture.body.Bytes()
+		rec.ExpiresAt = time.Now().Add(idempotencyCfg.TTL)
+		if err := s.store.CompleteIdempotencyKey(ctx, rec); err != nil {
+			slog.WarnContext(ctx, "Falha ao guardar resposta da Idempotency-Key", "error", err)
+			return
+		}
+		idempotencyRequestsTotal.WithLabelValues(route, "stored").Inc()
+	}
+}
+
+// purgeIdempotencyKeys remove periodicamente as respostas expiradas até ctx
+// ser cancelado.
+func purgeIdempotencyKeys(ctx context.Context, store users.IdempotencyStore, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			deleted, err := store.DeleteExpiredIdempotencyKeys(ctx, time.Now())
+			if err != nil {
+				slog.WarnContext(ctx, "Falha ao remover Idempotency-Keys expiradas", "error", err)
+				continue
+			}
+			if deleted > 0 {
+				slog.DebugContext(ctx, "Idempotency-Keys expiradas removidas", "count", deleted)
+			}
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/luc4s023/DesafioObservabilidade/internal/users"
+)
+
+func TestIdempotentRegister(t *testing.T) {
+	s := newTestServer(t)
+	const route = "/api/users/register"
+	h := s.idempotent(route, s.registerUserHandler)
+	register := func(key, body string) *httptest.ResponseRecorder {
+		req := jsonRequest(http.MethodPost, route, body)
+		if key != "" {
+			req.Header.Set(idempotencyKeyHeader, key)
+		}
+		return serve("POST "+route, h, req)
+	}
+	body := `{"username":"ana","email":"ana@exemplo.com","password":"segredo123"}`
+
+	first := register("chave-1", body)
+	if first.Code != http.StatusCreated || first.Header().Get(idempotentReplayedHeader) != "" {
+		t.Fatalf("primeira requisição: status %d, replayed %q (%s)", first.Code, first.Header().Get(idempotentReplayedHeader), first.Body)
+	}
+
+	// O mesmo corpo com as chaves noutra ordem é a mesma requisição.
+	replay := register("chave-1", `{"password":"segredo123", "email":"ana@exemplo.com","username":"ana"}`)
+	if replay.Code != http.StatusCreated || replay.Header().Get(idempotentReplayedHeader) != "true" {
+		t.Fatalf("repetição: status %d, replayed %q, quer 201 e true", replay.Code, replay.Header().Get(idempotentReplayedHeader))
+	}
+	if replay.Body.String() != first.Body.String() {
+		t.Errorf("repetição devolveu %s, quer %s", replay.Body, first.Body)
+	}
+
+	checkProblem(t, register("chave-1", `{"username":"bia","email":"bia@exemplo.com","password":"segredo123"}`),
+		http.StatusUnprocessableEntity, errorTypeIdempotencyMismatch)
+	// Sem a chave, o pedido é executado de novo.
+	checkProblem(t, register("", body), http.StatusConflict, errorTypeUsernameTaken)
+
+	// Uma reserva sem resposta é uma requisição ainda em andamento.
+	req := jsonRequest(http.MethodPost, route, body)
+	_, reserved, err := s.store.ReserveIdempotencyKey(context.Background(), users.IdempotencyRecord{
+		Key:         http.MethodPost + " " + route + " chave-2",
+		Fingerprint: requestFingerprint(req, []byte(body)),
+		ExpiresAt:   time.Now().Add(time.Minute),
+	}, time.Now())
+	if err != nil || !reserved {
+		t.Fatalf("ReserveIdempotencyKey: reserved %v, erro %v", reserved, err)
+	}
+	rec := register("chave-2", body)
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("409 sem Retry-After")
+	}
+	checkProblem(t, rec, http.StatusConflict, errorTypeIdempotencyInProgress)
+}
+
+func TestIdempotentReleasesServerErrors(t *testing.T) {
+	s := newTestServer(t)
+	const route = "/api/users/register"
+	calls := 0
+	h := s.idempotent(route, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			writeProblem(w, r, http.StatusInternalServerError, errorTypeInternal, "falha")
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	})
+	send := func() *httptest.ResponseRecorder {
+		req := jsonRequest(http.MethodPost, route, `{"username":"ana"}`)
+		req.Header.Set(idempotencyKeyHeader, "chave-1")
+		return serve("POST "+route, h, req)
+	}
+
+	if rec := send(); rec.Code != http.StatusInternalServerError {
+		t.Fatalf("primeira tentativa: status %d, quer 500", rec.Code)
+	}
+	// A resposta 5xx não foi guardada: a nova tentativa é executada.
+	if rec := send(); rec.Code != http.StatusCreated || calls != 2 {
+		t.Errorf("nova tentativa: status %d com %d chamadas, quer 201 e 2", rec.Code, calls)
+	}
+}
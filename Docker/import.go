@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/luc4s023/DesafioObservabilidade/internal/users"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var usersImportRowsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: metricsNamespace,
+	Name:      "users_import_rows_total",
+	Help:      "Linhas processadas por POST /api/users/import fora do dry_run, por resultado (created, conflict, invalid); created só conta linhas gravadas.",
+}, []string{"status"})
+
+const (
+	// maxImportBytes limita o corpo de POST /api/users/import.
+	maxImportBytes = 10 << 20
+	// maxImportRows limita os utilizadores de uma importação. O hash de cada
+	// senha é feito durante a requisição e leva cerca de 0,2 s num núcleo com
+	// o argon2id padrão: 1000 linhas cabem em importWriteTimeout.
+	maxImportRows = 1000
+	// importWriteTimeout substitui HTTP_WRITE_TIMEOUT na importação, para que
+	// o relatório chegue ao cliente mesmo depois de gravadas muitas linhas.
+	importWriteTimeout = 5 * time.Minute
+)
+
+// importFormat escolhe o formato por ?format= ou, sem ele, pelo Content-Type.
+func importFormat(r *http.Request) string {
+	if f := r.URL.Query().Get("format"); f != "" {
+		return f
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "text/csv":
+		return users.ImportCSV
+	case "application/x-ndjson", "application/json":
+		return users.ImportNDJSON
+	}
+	return ""
+}
+
+// importUsersHandler cria utilizadores em lote a partir de um CSV ou NDJSON
+// no corpo. ?mode=atomic (padrão) grava tudo ou nada; ?mode=best_effort grava
+// cada linha válida. ?dry_run=true só valida. A resposta é o relatório por
+// linha; erros são apenas os do arquivo ou do banco. Se o banco falhar a meio
+// de uma importação best_effort, a resposta é 500 com o relatório parcial.
+func (s *server) importUsersHandler(w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+	verr := &users.ValidationError{}
+	var opts users.ImportOptions
+	switch values.Get("mode") {
+	case "", "atomic":
+	case "best_effort":
+		opts.BestEffort = true
+	default:
+		verr.Fields = append(verr.Fields, users.FieldError{Field: "mode", Message: "modo inválido; use atomic ou best_effort"})
+	}
+	if v := values.Get("dry_run"); v != "" {
+		dryRun, err := strconv.ParseBool(v)
+		if err != nil {
+			verr.Fields = append(verr.Fields, users.FieldError{Field: "dry_run", Message: "dry_run deve ser true ou false"})
+		}
+		opts.DryRun = dryRun
+	}
+	format := importFormat(r)
+	if format != users.ImportCSV && format != users.ImportNDJSON {
+		verr.Fields = append(verr.Fields, users.FieldError{Field: "format", Message: "formato inválido; use csv ou ndjson (?format= ou Content-Type)"})
+	}
+	if len(verr.Fields) > 0 {
+		writeError(w, r, verr, "Erro ao importar utilizadores")
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxImportBytes))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeProblem(w, r, http.StatusRequestEntityTooLarge, errorTypePayloadTooLarge,
+				fmt.Sprintf("O arquivo excede %d MiB", maxImportBytes>>20))
+			return
+		}
+		writeProblem(w, r, http.StatusBadRequest, errorTypeBadRequest, "Erro ao ler o corpo da requisição")
+		return
+	}
+	rows, err := users.ParseImport(bytes.NewReader(body), format, maxImportRows)
+	if err != nil {
+		writeError(w, r, err, "Erro ao importar utilizadores")
+		return
+	}
+
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Now().Add(importWriteTimeout)); err != nil {
+		slog.WarnContext(r.Context(), "Não foi possível estender o prazo de escrita da importação", "error", err)
+	}
+
+	ctx := r.Context()
+	report, err := s.svc.ImportUsers(ctx, rows, opts)
+	if err != nil && !report.Committed {
+		writeError(w, r, err, "Erro ao importar utilizadores")
+		return
+	}
+
+	if !opts.DryRun {
+		if report.Committed {
+			usersImportRowsTotal.WithLabelValues(users.ImportCreated).Add(float64(report.Created))
+		}
+		usersImportRowsTotal.WithLabelValues(users.ImportConflict).Add(float64(report.Conflicts))
+		usersImportRowsTotal.WithLabelValues(users.ImportInvalid).Add(float64(report.Invalid))
+	}
+	slog.InfoContext(ctx, "Importação de utilizadores concluída", "audit", true,
+		"format", format, "mode", report.Mode, "dry_run", report.DryRun, "committed", report.Committed,
+		"rows", len(report.Rows), "created", report.Created, "conflicts", report.Conflicts, "invalid", report.Invalid,
+		"not_processed", report.NotProcessed)
+
+	status := http.StatusOK
+	if err != nil {
+		// Parte das linhas já foi gravada; só o relatório diz ao cliente quais.
+		slog.ErrorContext(ctx, "Importação de utilizadores interrompida", "error", err)
+		setErrorType(w, errorTypeInternal)
+		status = http.StatusInternalServerError
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/luc4s023/DesafioObservabilidade/internal/users"
+)
+
+// Tamanho de página de GET /api/users quando ?limit= não é informado e o
+// máximo aceito; limites maiores são reduzidos a maxPageSize.
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+// nextCursorHeader leva o cursor da próxima página, também presente no Link rel="next".
+const nextCursorHeader = "X-Next-Cursor"
+
+// parseListQuery lê os parâmetros de listagem: limit, cursor, sort
+// (id, username, created_at), order (asc, desc), email_domain, status, role e o
+// intervalo created_from/created_to (RFC 3339). Sem limit usa defaultLimit;
+// maxLimit, se maior que 0, reduz limites maiores. Erros de formato devolvem
+// um *users.ValidationError com o parâmetro em Field.
+func parseListQuery(values url.Values, defaultLimit, maxLimit int) (users.ListQuery, error) {
+	q := users.ListQuery{
+		Limit:       defaultLimit,
+		Sort:        values.Get("sort"),
+		EmailDomain: values.Get("email_domain"),
+		Status:      values.Get("status"),
+		Role:        values.Get("role"),
+	}
+	verr := &users.ValidationError{}
+	invalid := func(field, message string) {
+		verr.Fields = append(verr.Fields, users.FieldError{Field: field, Message: message})
+	}
+
+	if v := values.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			invalid("limit", "limit deve ser um inteiro positivo")
+		}
+		q.Limit = n
+		if maxLimit > 0 {
+			q.Limit = min(n, maxLimit)
+		}
+	}
+	switch values.Get("order") {
+	case "", "asc":
+	case "desc":
+		q.Desc = true
+	default:
+		invalid("order", "order deve ser asc ou desc")
+	}
+	if v := values.Get("cursor"); v != "" {
+		c, err := users.DecodeCursor(v)
+		if err != nil {
+			invalid("cursor", "cursor inválido")
+		}
+		q.After = c
+	}
+	for _, p := range []struct {
+		name string
+		dst  *time.Time
+	}{{"created_from", &q.CreatedFrom}, {"created_to", &q.CreatedTo}} {
+		v := values.Get(p.name)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			invalid(p.name, p.name+" deve estar no formato RFC 3339 (ex.: 2024-01-31T00:00:00Z)")
+		}
+		*p.dst = t
+	}
+
+	if len(verr.Fields) > 0 {
+		return users.ListQuery{}, verr
+	}
+	return q, nil
+}
+
+// setPageLinks publica o cursor da próxima página em X-Next-Cursor e num
+// cabeçalho Link rel="next" com os mesmos parâmetros da requisição.
+func setPageLinks(w http.ResponseWriter, r *http.Request, nextCursor string) {
+	if nextCursor == "" {
+		return
+	}
+	values := r.URL.Query()
+	values.Set("cursor", nextCursor)
+	next := url.URL{Path: r.URL.Path, RawQuery: values.Encode()}
+	w.Header().Set(nextCursorHeader, nextCursor)
+	w.Header().Set("Link", "<"+next.String()+`>; rel="next"`)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+type ctxKey int
+
+const (
+	requestIDKey ctxKey = iota
+	routeKey
+	userIDKey
+	identityKey
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// initLogger configura o slog.Default. cfg.Format escolhe o handler ("json",
+// o padrão, ou "text") e cfg.Level o nível mínimo (debug, info, warn, error).
+func initLogger(cfg logConfig) {
+	slog.SetDefault(newLogger(os.Stdout, cfg.Format, cfg.Level))
+}
+
+func newLogger(w io.Writer, format, level string) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: parseLogLevel(level)}
+
+	var h slog.Handler
+	if strings.EqualFold(format, "text") {
+		h = slog.NewTextHandler(w, opts)
+	} else {
+		h = slog.NewJSONHandler(w, opts)
+	}
+
+	return slog.New(contextHandler{h}).With(
+		slog.String("service", serviceName),
+		slog.String("version", serviceVersion),
+	)
+}
+
+func parseLogLevel(level string) slog.Level {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return slog.LevelInfo
+	}
+	return l
+}
+
+// contextHandler acrescenta a cada registro os campos conhecidos no contexto:
+// request_id, route, user_id, trace_id e span_id.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id, ok := ctx.Value(requestIDKey).(string); ok {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	if route, ok := ctx.Value(routeKey).(string); ok {
+		r.AddAttrs(slog.String("route", route))
+	}
+	if userID, ok := ctx.Value(userIDKey).(int64); ok {
+		r.AddAttrs(slog.Int64("user_id", userID))
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r.AddAttrs(
+			slog.String("trace_id", sc.TraceID().String()),
+			slog.String("span_id", sc.SpanID().String()),
+		)
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// withUserID associa ao contexto o ID do utilizador envolvido na requisição.
+func withUserID(ctx context.Context, id int64) context.Context {
+	return context.WithValue(ctx, userIDKey, id)
+}
+
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// requestContext garante um request ID (reaproveitando o X-Request-ID recebido)
+// e guarda-o no contexto junto com o template da rota.
+func requestContext(route string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if id == "" || len(id) > 128 {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+
+		ctx := context.WithValue(r.Context(), requestIDKey, id)
+		ctx = context.WithValue(ctx, routeKey, route)
+		next(w, r.WithContext(ctx))
+	}
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// fatal registra o erro e encerra o processo, substituindo log.Fatalf.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const metricsNamespace = "usuarios"
+
+// Métricas RED (Rate, Errors, Duration) dos handlers da API. O label "route"
+// recebe o template da rota (ex.: /api/users/{id}) e nunca o caminho bruto,
+// para manter a cardinalidade baixa.
+var (
+	httpRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_requests_total",
+		Help:      "Total de requisições HTTP recebidas, por rota, método e status.",
+	}, []string{"route", "method", "code"})
+
+	httpRequestErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_request_errors_total",
+		Help:      "Total de requisições HTTP respondidas com erro de servidor (5xx).",
+	}, []string{"route", "method", "code"})
+
+	httpRequestsInFlight = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_requests_in_flight",
+		Help:      "Requisições HTTP da API em andamento.",
+	})
+
+	passwordRehashTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "password_rehash_total",
+		Help:      "Hashes de senha regravados com o algoritmo atual após um login bem-sucedido.",
+	}, []string{"from", "to"})
+
+	authLoginTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "auth_login_total",
+		Help:      "Tentativas de login, por resultado e motivo.",
+	}, []string{"result", "reason"})
+
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latência das requisições HTTP em segundos.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "code"})
+)
+
+// statusRecorder guarda o status escrito pelo handler e o error_type marcado
+// por setErrorType para uso nas métricas.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	errorType   string
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	if !r.wroteHeader {
+		r.status = code
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if !r.wroteHeader {
+		r.WriteHeader(http.StatusOK)
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap permite que http.ResponseController alcance o ResponseWriter original.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// instrumentHandler registra contagem, erros e latência de cada requisição
+// atendida por next, rotulando-as com o template da rota informado, e emite
+// o log de acesso correspondente.
+func instrumentHandler(route string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		httpRequestsInFlight.Inc()
+		defer httpRequestsInFlight.Dec()
+
+		next(rec, r)
+
+		elapsed := time.Since(start)
+		code := strconv.Itoa(rec.status)
+		httpRequestsTotal.WithLabelValues(route, r.Method, code).Inc()
+		httpRequestDuration.WithLabelValues(route, r.Method, code).Observe(elapsed.Seconds())
+
+		level := slog.LevelInfo
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", rec.status),
+			slog.Float64("duration_ms", float64(elapsed.Microseconds())/1000),
+		}
+		if rec.status >= http.StatusBadRequest {
+			errorType := rec.errorType
+			if errorType == "" && rec.status >= http.StatusInternalServerError {
+				errorType = errorTypeInternal
+			} else if errorType == "" {
+				errorType = errorTypeOther
+			}
+			httpErrorResponsesTotal.WithLabelValues(route, code, errorType).Inc()
+			attrs = append(attrs, slog.String("error_type", errorType))
+		}
+		if rec.status >= http.StatusInternalServerError {
+			httpRequestErrorsTotal.WithLabelValues(route, r.Method, code).Inc()
+			level = slog.LevelError
+		}
+		slog.LogAttrs(r.Context(), level, "Requisição HTTP atendida", attrs...)
+	}
+}
+
+// metricsHandler expõe as métricas no formato Prometheus/OpenMetrics.
+func metricsHandler() http.Handler {
+	return promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{
+		EnableOpenMetrics: true,
+	})
+}
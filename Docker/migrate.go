@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/luc4s023/DesafioObservabilidade/internal/users"
+)
+
+// runMigrateCommand implementa o subcomando "migrate":
+//
+//	migrate status | up | down N | force N
+func runMigrateCommand(ctx context.Context, db *sql.DB, args []string) error {
+	const usage = "uso: migrate status | up | down N | force N"
+	if len(args) == 0 {
+		return errors.New(usage)
+	}
+
+	m, err := users.NewMigrator(db)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "status":
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "VERSÃO\tNOME\tAPLICADA EM")
+		for _, s := range statuses {
+			applied := "pendente"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(tw, "%d\t%s\t%s\n", s.Version, s.Name, applied)
+		}
+		return tw.Flush()
+
+	case "up":
+		count, err := m.Up(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%d migração(ões) aplicada(s).\n", count)
+		return nil
+
+	case "down":
+		if len(args) != 2 {
+			return errors.New(usage)
+		}
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n <= 0 {
+			return fmt.Errorf("número de migrações inválido: %q", args[1])
+		}
+		count, err := m.Down(ctx, n)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%d migração(ões) revertida(s).\n", count)
+		return nil
+
+	case "force":
+		if len(args) != 2 {
+			return errors.New(usage)
+		}
+		version, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil || version < 0 {
+			return fmt.Errorf("versão inválida: %q", args[1])
+		}
+		if err := m.Force(ctx, version); err != nil {
+			return err
+		}
+		fmt.Printf("Schema marcado na versão %d.\n", version)
+		return nil
+
+	default:
+		return errors.New(usage)
+	}
+}
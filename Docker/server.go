@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/luc4s023/DesafioObservabilidade/internal/users"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// serverConfig reúne o endereço e os timeouts do http.Server e do
+// encerramento gracioso.
+type serverConfig struct {
+	// Addr é o endereço de escuta ("host:porta" ou ":porta").
+	Addr              string
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	// ShutdownDelay é o tempo em que /readyz já falha antes de o servidor
+	// parar de aceitar conexões, para o balanceador retirar a instância.
+	ShutdownDelay time.Duration
+	// ShutdownTimeout limita a espera pelas requisições em andamento.
+	ShutdownTimeout time.Duration
+}
+
+func defaultServerConfig() serverConfig {
+	return serverConfig{
+		Addr:              ":8080",
+		ReadTimeout:       15 * time.Second,
+		ReadHeaderTimeout: 5 * time.Second,
+		WriteTimeout:      30 * time.Second,
+		IdleTimeout:       120 * time.Second,
+		ShutdownDelay:     5 * time.Second,
+		ShutdownTimeout:   25 * time.Second,
+	}
+}
+
+func newHTTPServer(addr string, handler http.Handler, cfg serverConfig) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadTimeout:       cfg.ReadTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		ErrorLog:          slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+	}
+}
+
+var (
+	shutdownInProgress = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "shutdown_in_progress",
+		Help:      "1 enquanto o encerramento gracioso está em andamento.",
+	})
+
+	shutdownPhaseDuration = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "shutdown_phase_duration_seconds",
+		Help:      "Duração de cada fase do encerramento gracioso.",
+	}, []string{"phase", "result"})
+)
+
+// gracefulShutdown executa, em ordem, as fases de encerramento: marcar o
+// readiness como falho, drenar as requisições em andamento, fechar o pool do
+// banco e descarregar os spans pendentes. Cada fase é registrada em log e em
+// métrica.
+func gracefulShutdown(srv *http.Server, cfg serverConfig, store users.Store, flushTracing func(context.Context) error) {
+	shutdownInProgress.Set(1)
+	slog.Info("Encerramento gracioso iniciado", "shutdown_delay", cfg.ShutdownDelay.String(), "shutdown_timeout", cfg.ShutdownTimeout.String())
+
+	runShutdownPhase("readiness", func() error {
+		shuttingDown.Store(true)
+		time.Sleep(cfg.ShutdownDelay)
+		return nil
+	})
+
+	runShutdownPhase("drain", func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			srv.Close()
+			return err
+		}
+		return nil
+	})
+
+	runShutdownPhase("db_close", func() error {
+		return store.Close()
+	})
+
+	runShutdownPhase("tracing_flush", func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return flushTracing(ctx)
+	})
+
+	slog.Info("Encerramento gracioso concluído")
+}
+
+func runShutdownPhase(phase string, fn func() error) {
+	slog.Info("Fase de encerramento iniciada", "phase", phase)
+	start := time.Now()
+	err := fn()
+	elapsed := time.Since(start)
+
+	result := "ok"
+	if err != nil {
+		result = "error"
+		slog.Error("Fase de encerramento falhou", "phase", phase, "error", err, "duration_ms", elapsed.Milliseconds())
+	} else {
+		slog.Info("Fase de encerramento concluída", "phase", phase, "duration_ms", elapsed.Milliseconds())
+	}
+	shutdownPhaseDuration.WithLabelValues(phase, result).Set(elapsed.Seconds())
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andybalholm/brotli"
+)
+
+// staticFiles são os ficheiros servidos em "/"; nada fora de static/ é
+// acessível pela web.
+//
+//go:embed static
+var staticFiles embed.FS
+
+const (
+	// hashedAssetCacheControl vale para os nomes com o hash do conteúdo, que
+	// mudam sempre que o conteúdo muda.
+	hashedAssetCacheControl = "public, max-age=31536000, immutable"
+	// staticCacheControl obriga a revalidar (via ETag) o index.html e os
+	// nomes sem hash.
+	staticCacheControl = "no-cache"
+	// minCompressSize é o tamanho abaixo do qual não vale a pena comprimir.
+	minCompressSize = 512
+)
+
+// staticEncodings são as codificações pré-comprimidas, em ordem de preferência.
+var staticEncodings = []string{"br", "gzip"}
+
+// encodingSuffix é a extensão dos ficheiros pré-comprimidos de cada codificação.
+var encodingSuffix = map[string]string{"br": ".br", "gzip": ".gz"}
+
+// staticAsset é um ficheiro pronto para servir, com as suas variantes
+// comprimidas.
+type staticAsset struct {
+	contentType string
+	// hash identifica o conteúdo (sem compressão) e forma o ETag.
+	hash string
+	// hashedPath é o caminho com o hash ("/app.3f2a1b9c.js"); vazio no HTML,
+	// que é sempre pedido pelo nome.
+	hashedPath string
+	// variants guarda o conteúdo por Content-Encoding; "" é o original.
+	variants map[string][]byte
+}
+
+// staticSite serve os ficheiros embutidos. Caminhos sem extensão que não
+// correspondem a ficheiros recebem o index.html (fallback de SPA).
+type staticSite struct {
+	assets map[string]*staticAsset
+	index  *staticAsset
+}
+
+// newStaticSite lê todos os ficheiros de fsys. Ficheiros .gz e .br ao lado
+// de outro ficheiro são usados como as suas variantes; as que faltarem são
+// comprimidas aqui. Nos ficheiros HTML, as referências "/<ficheiro>" a outros
+// ficheiros são trocadas pelo caminho com hash, e por isso as suas variantes
+// são sempre geradas aqui.
+func newStaticSite(fsys fs.FS) (*staticSite, error) {
+	files := map[string][]byte{}
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		files["/"+name] = data
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("erro ao ler os ficheiros estáticos: %v", err)
+	}
+
+	site := &staticSite{assets: map[string]*staticAsset{}}
+	var htmlPaths []string
+	for name, data := range files {
+		if base, ok := precompressedBase(name); ok && files[base] != nil {
+			continue
+		}
+		if isHTML(name) {
+			htmlPaths = append(htmlPaths, name)
+			continue
+		}
+		asset := newStaticAsset(name, data, files)
+		site.assets[name] = asset
+		site.assets[asset.hashedPath] = asset
+	}
+
+	// O HTML é processado por último para que as referências apontem para os
+	// caminhos com hash.
+	slices.Sort(htmlPaths)
+	for _, name := range htmlPaths {
+		data := files[name]
+		for assetPath, asset := range site.assets {
+			if assetPath == asset.hashedPath {
+				continue
+			}
+			for _, quote := range []string{`"`, `'`} {
+				data = bytes.ReplaceAll(data, []byte(quote+assetPath+quote), []byte(quote+asset.hashedPath+quote))
+			}
+		}
+		asset := newStaticAsset(name, data, nil)
+		asset.hashedPath = ""
+		site.assets[name] = asset
+	}
+
+	site.index = site.assets["/index.html"]
+	if site.index == nil {
+		return nil, fmt.Errorf("erro ao ler os ficheiros estáticos: index.html não encontrado")
+	}
+	return site, nil
+}
+
+// precompressedBase devolve o ficheiro de que name seria a variante comprimida.
+func precompressedBase(name string) (string, bool) {
+	for _, suffix := range encodingSuffix {
+		if base, ok := strings.CutSuffix(name, suffix); ok {
+			return base, true
+		}
+	}
+	return "", false
+}
+
+func isHTML(name string) bool {
+	return path.Ext(name) == ".html"
+}
+
+// newStaticAsset calcula o hash e as variantes de data; precompressed, se
+// não for nil, é consultado para os ficheiros name.br e name.gz.
+func newStaticAsset(name string, data []byte, precompressed map[string][]byte) *staticAsset {
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])[:16]
+	ext := path.Ext(name)
+
+	contentType := mime.TypeByExtension(ext)
+	if contentType == "" {
+		contentType = http.DetectContentType(data)
+	}
+	asset := &staticAsset{
+		contentType: contentType,
+		hash:        hash,
+		hashedPath:  strings.TrimSuffix(name, ext) + "." + hash[:8] + ext,
+		variants:    map[string][]byte{"": data},
+	}
+
+	for _, enc := range staticEncodings {
+		if v, ok := precompressed[name+encodingSuffix[enc]]; ok {
+			asset.variants[enc] = v
+			continue
+		}
+		if len(data) < minCompressSize || !compressible(contentType) {
+			continue
+		}
+		if v := compress(enc, data); len(v) < len(data) {
+			asset.variants[enc] = v
+		}
+	}
+	return asset
+}
+
+// compressible indica os tipos em que a compressão compensa; imagens e
+// fontes já vêm comprimidas.
+func compressible(contentType string) bool {
+	return strings.HasPrefix(contentType, "text/") ||
+		strings.Contains(contentType, "javascript") ||
+		strings.Contains(contentType, "json") ||
+		strings.Contains(contentType, "xml") ||
+		strings.Contains(contentType, "svg")
+}
+
+func compress(enc string, data []byte) []byte {
+	var buf bytes.Buffer
+	switch enc {
+	case "br":
+		w := brotli.NewWriterLevel(&buf, brotli.BestCompression)
+		w.Write(data)
+		w.Close()
+	case "gzip":
+		w, _ := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+		w.Write(data)
+		w.Close()
+	}
+	return buf.Bytes()
+}
+
+// acceptsEncoding indica se o Accept-Encoding aceita enc com q > 0.
+func acceptsEncoding(header, enc string) bool {
+	accepted := false
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != enc && name != "*" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		if name == enc {
+			return q > 0
+		}
+		accepted = q > 0
+	}
+	return accepted
+}
+
+func (site *staticSite) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeProblem(w, r, http.StatusMethodNotAllowed, errorTypeMethodNotAllowed, "Método não permitido")
+		return
+	}
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		writeProblem(w, r, http.StatusNotFound, errorTypeNotFound, "Rota não encontrada: "+r.URL.Path)
+		return
+	}
+
+	asset, ok := site.assets[r.URL.Path]
+	switch {
+	case r.URL.Path == "/":
+		asset = site.index
+	case !ok && path.Ext(r.URL.Path) != "":
+		http.NotFound(w, r)
+		return
+	case !ok:
+		asset = site.index
+	}
+
+	h := w.Header()
+	if r.URL.Path == asset.hashedPath {
+		h.Set("Cache-Control", hashedAssetCacheControl)
+	} else {
+		h.Set("Cache-Control", staticCacheControl)
+	}
+	h.Set("Content-Type", asset.contentType)
+	h.Set("X-Content-Type-Options", "nosniff")
+
+	encoding := ""
+	if len(asset.variants) > 1 {
+		h.Add("Vary", "Accept-Encoding")
+		for _, enc := range staticEncodings {
+			if _, ok := asset.variants[enc]; ok && acceptsEncoding(r.Header.Get("Accept-Encoding"), enc) {
+				encoding = enc
+				break
+			}
+		}
+	}
+	etag := asset.hash
+	if encoding != "" {
+		h.Set("Content-Encoding", encoding)
+		etag += "-" + encoding
+	}
+	h.Set("ETag", `"`+etag+`"`)
+
+	// ServeContent trata If-None-Match (304), HEAD e Range.
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(asset.variants[encoding]))
+}
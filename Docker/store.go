@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/luc4s023/DesafioObservabilidade/internal/users"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// openStore abre o armazenamento escolhido em cfg.Backend: "postgres" (o
+// padrão, com as credenciais de cfg.Postgres), "sqlite" (arquivo em
+// cfg.SQLitePath) ou "memory", que não persiste nada e dispensa banco de
+// dados. Com o Postgres, espera o banco ficar acessível (ver waitForDB) e
+// vigia os ficheiros de segredo até ctx ser cancelado (ver
+// watchPostgresSecrets).
+func openStore(ctx context.Context, cfg storeConfig) (users.Store, error) {
+	switch cfg.Backend {
+	case "", "postgres":
+		db, connector, err := openPostgres(ctx, cfg)
+		if err != nil {
+			return nil, err
+		}
+		if err := migrateOnStartup(ctx, db, cfg.MigrateOnStartup); err != nil {
+			db.Close()
+			return nil, err
+		}
+		go watchPostgresSecrets(ctx, connector, cfg.Postgres.Files(), cfg.SecretRefreshInterval)
+		return users.NewPostgresStore(db), nil
+	case "sqlite":
+		return users.OpenSQLite(ctx, cfg.SQLitePath)
+	case "memory":
+		return users.NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("STORE_BACKEND desconhecido: %q (use postgres, sqlite ou memory)", cfg.Backend)
+	}
+}
+
+// migrateOnStartup aplica as migrações pendentes quando enabled
+// (MIGRATE_ON_STARTUP=true). Sem isso, o schema é gerido pelo subcomando
+// "migrate".
+func migrateOnStartup(ctx context.Context, db *sql.DB, enabled bool) error {
+	if !enabled {
+		return nil
+	}
+	m, err := users.NewMigrator(db)
+	if err != nil {
+		return fmt.Errorf("erro ao carregar as migrações: %v", err)
+	}
+	count, err := m.Up(ctx)
+	if err != nil {
+		return fmt.Errorf("erro ao aplicar as migrações: %v", err)
+	}
+	slog.Info("Schema do banco de dados atualizado", "applied", count)
+	return nil
+}
+
+var postgresSecretReloadsTotal = promauto.NewCounter(prometheus.CounterOpts{
+	Namespace: metricsNamespace,
+	Name:      "postgres_secret_reloads_total",
+	Help:      "Trocas detetadas nos ficheiros de segredo do PostgreSQL, cada uma seguida da renovação das conexões.",
+})
+
+// watchPostgresSecrets relê files a cada interval e, quando algum muda (ex.:
+// rotação de um segredo do Docker ou do Kubernetes), faz o pool renovar as
+// conexões com as novas credenciais. Os ficheiros são comparados pelo
+// conteúdo, porque os segredos do Kubernetes são trocados por links
+// simbólicos e não mantêm a data de modificação.
+func watchPostgresSecrets(ctx context.Context, connector *users.PostgresConnector, files []string, interval time.Duration) {
+	if len(files) == 0 || interval <= 0 {
+		return
+	}
+	sums := map[string][sha256.Size]byte{}
+	for _, f := range files {
+		if data, err := os.ReadFile(f); err == nil {
+			sums[f] = sha256.Sum256(data)
+		}
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		changed := false
+		for _, f := range files {
+			data, err := os.ReadFile(f)
+			if err != nil {
+				slog.WarnContext(ctx, "Falha ao reler o ficheiro de segredo do PostgreSQL", "error", err, "file", f)
+				continue
+			}
+			if sum := sha256.Sum256(data); sum != sums[f] {
+				sums[f] = sum
+				changed = true
+				slog.InfoContext(ctx, "Ficheiro de segredo do PostgreSQL alterado", "file", f)
+			}
+		}
+		if changed {
+			connector.Redial()
+			postgresSecretReloadsTotal.Inc()
+			slog.InfoContext(ctx, "Conexões do PostgreSQL renovadas com as novas credenciais")
+		}
+	}
+}
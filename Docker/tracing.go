@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// initTracing configura o TracerProvider global com exportação OTLP e o
+// propagador W3C (traceparent/tracestate + baggage).
+//
+// O endpoint e o protocolo ("grpc" ou "http/protobuf", o padrão da
+// especificação) vêm de cfg; as variáveis OTEL_EXPORTER_OTLP_TRACES_* do SDK,
+// mais específicas, têm precedência, e as demais opções do exportador
+// (cabeçalhos, TLS, timeout) continuam a vir das variáveis padrão
+// OTEL_EXPORTER_OTLP_*. Com o exportador "none" nenhum span é exportado, mas a
+// propagação continua ativa.
+func initTracing(ctx context.Context, cfg telemetryConfig) (func(context.Context) error, error) {
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		slog.Warn("Erro no OpenTelemetry", "error", err)
+	}))
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	if cfg.TracesExporter == "none" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := newTraceExporter(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.New(ctx,
+		resource.WithSchemaURL(semconv.SchemaURL),
+		resource.WithAttributes(
+			semconv.ServiceName(serviceName),
+			semconv.ServiceVersion(serviceVersion),
+		),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+		resource.WithHost(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao criar resource do OpenTelemetry: %v", err)
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(tp)
+
+	return tp.Shutdown, nil
+}
+
+func newTraceExporter(ctx context.Context, cfg telemetryConfig) (sdktrace.SpanExporter, error) {
+	protocol := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_PROTOCOL")
+	if protocol == "" {
+		protocol = cfg.OTLPProtocol
+	}
+	// OTEL_EXPORTER_OTLP_TRACES_ENDPOINT é lida pelo próprio SDK.
+	endpoint := ""
+	if os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" {
+		endpoint = cfg.OTLPEndpoint
+	}
+
+	switch protocol {
+	case "grpc":
+		var opts []otlptracegrpc.Option
+		if endpoint != "" {
+			opts = append(opts, otlptracegrpc.WithEndpointURL(endpoint))
+		}
+		return otlptracegrpc.New(ctx, opts...)
+	case "", "http/protobuf":
+		var opts []otlptracehttp.Option
+		if endpoint != "" {
+			// Como no SDK, o endpoint base recebe o caminho do sinal.
+			opts = append(opts, otlptracehttp.WithEndpointURL(strings.TrimSuffix(endpoint, "/")+"/v1/traces"))
+		}
+		return otlptracehttp.New(ctx, opts...)
+	default:
+		return nil, fmt.Errorf("protocolo OTLP não suportado: %q (use grpc ou http/protobuf)", protocol)
+	}
+}
+
+// traceHandler cria um span de servidor para cada requisição, extraindo o
+// contexto W3C recebido e devolvendo o traceparent nos cabeçalhos da resposta.
+func traceHandler(route string, next http.HandlerFunc) http.HandlerFunc {
+	inner := func(w http.ResponseWriter, r *http.Request) {
+		span := trace.SpanFromContext(r.Context())
+		span.SetAttributes(semconv.HTTPRoute(route))
+		otel.GetTextMapPropagator().Inject(r.Context(), propagation.HeaderCarrier(w.Header()))
+		next(w, r)
+	}
+
+	h := otelhttp.NewHandler(http.HandlerFunc(inner), route,
+		otelhttp.WithSpanNameFormatter(func(operation string, r *http.Request) string {
+			return r.Method + " " + operation
+		}),
+	)
+	return h.ServeHTTP
+}
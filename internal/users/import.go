@@ -0,0 +1,361 @@
+package users
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// Formatos aceitos por ParseImport.
+const (
+	ImportCSV    = "csv"
+	ImportNDJSON = "ndjson"
+)
+
+// Resultados de cada linha em ImportRowResult.Status.
+const (
+	ImportCreated  = "created"
+	ImportConflict = "conflict"
+	ImportInvalid  = "invalid"
+	// ImportNotProcessed marca, no modo best_effort, as linhas válidas que
+	// não chegaram a ser gravadas porque a importação foi interrompida.
+	ImportNotProcessed = "not_processed"
+)
+
+// ImportRow é um utilizador lido do arquivo de importação; Line é a linha de
+// origem, usada no relatório.
+type ImportRow struct {
+	Line     int    `json:"-"`
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// importColumns são as colunas obrigatórias do cabeçalho CSV.
+var importColumns = []string{"username", "email", "password"}
+
+// ParseImport lê as linhas de um CSV (com cabeçalho username,email,password,
+// em qualquer ordem) ou de um NDJSON (um objeto por linha). Um arquivo mal
+// formado, vazio ou com mais de maxRows linhas (0 não limita) devolve um
+// *ValidationError com o campo "file" e nenhuma linha.
+func ParseImport(r io.Reader, format string, maxRows int) ([]ImportRow, error) {
+	var rows []ImportRow
+	var err error
+	switch format {
+	case ImportCSV:
+		rows, err = parseImportCSV(r, maxRows)
+	case ImportNDJSON:
+		rows, err = parseImportNDJSON(r, maxRows)
+	default:
+		return nil, invalidImport("formato inválido; use csv ou ndjson")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, invalidImport("o arquivo não tem utilizadores para importar")
+	}
+	return rows, nil
+}
+
+func invalidImport(format string, args ...any) error {
+	return &ValidationError{Fields: []FieldError{{Field: "file", Message: fmt.Sprintf(format, args...)}}}
+}
+
+func tooManyImportRows(maxRows int) error {
+	return invalidImport("o arquivo excede o máximo de %d utilizadores", maxRows)
+}
+
+func parseImportCSV(r io.Reader, maxRows int) ([]ImportRow, error) {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, invalidImport("CSV inválido: %v", err)
+	}
+	index := map[string]int{}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if _, dup := index[name]; dup || !slices.Contains(importColumns, name) {
+			return nil, invalidImport("coluna inválida ou repetida no cabeçalho: %q", name)
+		}
+		index[name] = i
+	}
+	for _, name := range importColumns {
+		if _, ok := index[name]; !ok {
+			return nil, invalidImport("o cabeçalho CSV deve ter a coluna %s", name)
+		}
+	}
+
+	var rows []ImportRow
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, invalidImport("CSV inválido: %v", err)
+		}
+		if maxRows > 0 && len(rows) == maxRows {
+			return nil, tooManyImportRows(maxRows)
+		}
+		line, _ := cr.FieldPos(0)
+		rows = append(rows, ImportRow{
+			Line:     line,
+			Username: record[index["username"]],
+			Email:    record[index["email"]],
+			Password: record[index["password"]],
+		})
+	}
+}
+
+func parseImportNDJSON(r io.Reader, maxRows int) ([]ImportRow, error) {
+	sc := bufio.NewScanner(r)
+	var rows []ImportRow
+	for line := 1; sc.Scan(); line++ {
+		b := bytes.TrimSpace(sc.Bytes())
+		if len(b) == 0 {
+			continue
+		}
+		if maxRows > 0 && len(rows) == maxRows {
+			return nil, tooManyImportRows(maxRows)
+		}
+		row := ImportRow{Line: line}
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&row); err != nil || dec.More() {
+			if err == nil {
+				err = errors.New("mais de um valor na linha")
+			}
+			return nil, invalidImport("linha %d: JSON inválido: %v", line, err)
+		}
+		rows = append(rows, row)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, invalidImport("NDJSON inválido: %v", err)
+	}
+	return rows, nil
+}
+
+// ImportOptions controla ImportUsers.
+type ImportOptions struct {
+	// DryRun valida e verifica os conflitos sem gravar nada.
+	DryRun bool
+	// BestEffort grava cada linha válida por conta própria. Sem ele a
+	// importação é tudo-ou-nada: uma única linha inválida ou em conflito
+	// desfaz todas.
+	BestEffort bool
+}
+
+// ImportRowResult é o resultado de uma linha. Conflict indica a restrição
+// violada ("username" ou "email"); Errors traz os campos inválidos ou o
+// conflito. ID só é preenchido quando a linha foi de facto gravada.
+type ImportRowResult struct {
+	Line     int          `json:"line"`
+	Username string       `json:"username"`
+	Status   string       `json:"status"`
+	ID       int64        `json:"id,omitempty"`
+	Conflict string       `json:"conflict,omitempty"`
+	Errors   []FieldError `json:"errors,omitempty"`
+}
+
+// ImportReport resume uma importação. Committed indica se as linhas
+// "created" foram gravadas; é falso em DryRun e no modo tudo-ou-nada com
+// alguma linha recusada, casos em que "created" quer dizer "seria criado".
+type ImportReport struct {
+	Mode         string            `json:"mode"`
+	DryRun       bool              `json:"dry_run"`
+	Committed    bool              `json:"committed"`
+	Created      int               `json:"created"`
+	Conflicts    int               `json:"conflicts"`
+	Invalid      int               `json:"invalid"`
+	NotProcessed int               `json:"not_processed"`
+	Rows         []ImportRowResult `json:"rows"`
+}
+
+// errImportRollback desfaz a transação de ImportUsers sem ser um erro real.
+var errImportRollback = errors.New("importação desfeita")
+
+// ImportUsers cria os utilizadores de rows com as mesmas regras de
+// RegisterUser e devolve o resultado de cada linha. Linhas inválidas ou em
+// conflito não são erros; o erro devolvido é apenas o que impediu a
+// importação (ex.: falha do banco), e nesse caso nada é gravado no modo
+// tudo-ou-nada. No modo best_effort as linhas anteriores à falha já estão
+// gravadas: o relatório é devolvido junto com o erro, com Committed true e as
+// linhas seguintes como ImportNotProcessed.
+func (s *Service) ImportUsers(ctx context.Context, rows []ImportRow, opts ImportOptions) (ImportReport, error) {
+	report := ImportReport{Mode: "atomic", DryRun: opts.DryRun, Rows: make([]ImportRowResult, len(rows))}
+	if opts.BestEffort {
+		report.Mode = "best_effort"
+	}
+
+	// Valida e gera os hashes antes de abrir a transação, que no SQLite
+	// ocuparia a única conexão durante todo o trabalho de hash.
+	pending := make([]User, len(rows))
+	for i, row := range rows {
+		// Sem isso, um cliente que desistiu ocuparia a CPU até ao fim do arquivo.
+		if err := ctx.Err(); err != nil {
+			return ImportReport{}, err
+		}
+		username := strings.TrimSpace(row.Username)
+		email := strings.TrimSpace(row.Email)
+		password := normalizePassword(row.Password)
+		res := &report.Rows[i]
+		res.Line, res.Username = row.Line, username
+
+		if err := validateRegistration(username, email, password); err != nil {
+			var verr *ValidationError
+			errors.As(err, &verr)
+			res.Status, res.Errors = ImportInvalid, verr.Fields
+			continue
+		}
+		pending[i] = User{Username: username, Email: email}
+		if opts.DryRun {
+			continue
+		}
+		hash, err := s.Hasher.Hash(password)
+		if err != nil {
+			return ImportReport{}, fmt.Errorf("erro ao gerar hash da senha: %v", err)
+		}
+		pending[i].PasswordHash = hash
+	}
+
+	insert := func(store UserStore) error {
+		for i, u := range pending {
+			res := &report.Rows[i]
+			if res.Status == ImportInvalid {
+				continue
+			}
+			created, err := store.Create(ctx, u)
+			switch {
+			case err == nil:
+				res.Status, res.ID = ImportCreated, created.ID
+			case errors.Is(err, ErrUsernameTaken), errors.Is(err, ErrEmailTaken):
+				setImportConflict(res, u, err)
+			default:
+				return fmt.Errorf("erro ao importar a linha %d: %v", res.Line, err)
+			}
+		}
+		return nil
+	}
+
+	// check preenche o relatório como insert, mas apenas com leituras: cada
+	// linha é comparada com os utilizadores gravados e com as linhas
+	// anteriores do arquivo que seriam criadas.
+	check := func() error {
+		usernames, emails := map[string]bool{}, map[string]bool{}
+		for i, u := range pending {
+			res := &report.Rows[i]
+			if res.Status == ImportInvalid {
+				continue
+			}
+			err := s.importTaken(ctx, u, usernames, emails)
+			switch {
+			case err == nil:
+				res.Status = ImportCreated
+				usernames[u.Username], emails[u.Email] = true, true
+			case errors.Is(err, ErrUsernameTaken), errors.Is(err, ErrEmailTaken):
+				setImportConflict(res, u, err)
+			default:
+				return fmt.Errorf("erro ao verificar a linha %d: %v", res.Line, err)
+			}
+		}
+		return nil
+	}
+
+	var err error
+	switch {
+	case opts.DryRun:
+		err = check()
+	case opts.BestEffort:
+		err = insert(s.Store)
+		report.Committed = true
+		if err != nil {
+			// A linha que falhou e as seguintes ainda não têm resultado.
+			for i := range report.Rows {
+				if report.Rows[i].Status == "" {
+					report.Rows[i].Status = ImportNotProcessed
+				}
+			}
+		}
+	default:
+		err = s.Store.WithTx(ctx, func(tx UserStore) error {
+			if err := insert(tx); err != nil {
+				return err
+			}
+			for _, res := range report.Rows {
+				if res.Status != ImportCreated {
+					return errImportRollback
+				}
+			}
+			return nil
+		})
+		report.Committed = err == nil
+		if errors.Is(err, errImportRollback) {
+			err = nil
+		}
+	}
+	if err != nil && !report.Committed {
+		return ImportReport{}, err
+	}
+
+	for i := range report.Rows {
+		res := &report.Rows[i]
+		switch res.Status {
+		case ImportCreated:
+			report.Created++
+			if !report.Committed {
+				res.ID = 0
+			}
+		case ImportConflict:
+			report.Conflicts++
+		case ImportInvalid:
+			report.Invalid++
+		case ImportNotProcessed:
+			report.NotProcessed++
+		}
+	}
+	return report, err
+}
+
+// setImportConflict marca res como conflito com a restrição violada por err
+// (ErrUsernameTaken ou ErrEmailTaken).
+func setImportConflict(res *ImportRowResult, u User, err error) {
+	res.Status, res.Conflict = ImportConflict, "username"
+	if errors.Is(err, ErrEmailTaken) {
+		res.Conflict = "email"
+	}
+	res.Errors = []FieldError{{Field: res.Conflict, Message: conflictError(err, u.Username, u.Email, "").Error()}}
+}
+
+// importTaken diz se u colide com um utilizador gravado ou com uma linha
+// anterior do arquivo (usernames e emails), na mesma ordem que Create:
+// primeiro o username, depois o email.
+func (s *Service) importTaken(ctx context.Context, u User, usernames, emails map[string]bool) error {
+	if usernames[u.Username] {
+		return ErrUsernameTaken
+	}
+	if _, err := s.Store.GetByUsername(ctx, u.Username); err == nil {
+		return ErrUsernameTaken
+	} else if !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	if emails[u.Email] {
+		return ErrEmailTaken
+	}
+	if _, err := s.Store.GetByEmail(ctx, u.Email); err == nil {
+		return ErrEmailTaken
+	} else if !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// failingStore falha todo Create a partir do (failAfter+1)-ésimo, também
+// dentro de WithTx.
+type failingStore struct {
+	UserStore
+	failAfter int
+	calls     *int
+}
+
+func newFailingStore(failAfter int) *failingStore {
+	return &failingStore{UserStore: NewMemoryStore(), failAfter: failAfter, calls: new(int)}
+}
+
+func (s *failingStore) Create(ctx context.Context, u User) (User, error) {
+	*s.calls++
+	if *s.calls > s.failAfter {
+		return User{}, errors.New("conexão com o banco perdida")
+	}
+	return s.UserStore.Create(ctx, u)
+}
+
+func (s *failingStore) WithTx(ctx context.Context, fn func(UserStore) error) error {
+	return s.UserStore.WithTx(ctx, func(tx UserStore) error {
+		return fn(&failingStore{UserStore: tx, failAfter: s.failAfter, calls: s.calls})
+	})
+}
+
+func TestImportUsersBestEffortPartialFailure(t *testing.T) {
+	ctx := context.Background()
+	store := newFailingStore(2)
+	svc := NewService(store, testArgon2id)
+	rows := []ImportRow{
+		{Line: 2, Username: "ana", Email: "ana@exemplo.com", Password: "segredo1"},
+		{Line: 3, Username: "bia", Email: "invalido", Password: "segredo1"},
+		{Line: 4, Username: "caio", Email: "caio@exemplo.com", Password: "segredo1"},
+		{Line: 5, Username: "duda", Email: "duda@exemplo.com", Password: "segredo1"},
+		{Line: 6, Username: "edu", Email: "edu@exemplo.com", Password: "segredo1"},
+	}
+
+	report, err := svc.ImportUsers(ctx, rows, ImportOptions{BestEffort: true})
+	if err == nil {
+		t.Fatal("ImportUsers não devolveu a falha do banco")
+	}
+	if !report.Committed {
+		t.Fatalf("Committed = false, quer true: as linhas anteriores à falha já foram gravadas")
+	}
+
+	want := []string{ImportCreated, ImportInvalid, ImportCreated, ImportNotProcessed, ImportNotProcessed}
+	for i, res := range report.Rows {
+		if res.Status != want[i] {
+			t.Errorf("linha %d: status %q, quer %q", res.Line, res.Status, want[i])
+		}
+		if (res.Status == ImportCreated) != (res.ID != 0) {
+			t.Errorf("linha %d: ID %d com status %q", res.Line, res.ID, res.Status)
+		}
+	}
+	if report.Created != 2 || report.Invalid != 1 || report.NotProcessed != 2 {
+		t.Errorf("totais created=%d invalid=%d not_processed=%d, quer 2, 1 e 2",
+			report.Created, report.Invalid, report.NotProcessed)
+	}
+	for _, username := range []string{"ana", "caio"} {
+		if _, err := store.GetByUsername(ctx, username); err != nil {
+			t.Errorf("GetByUsername(%q): %v", username, err)
+		}
+	}
+}
+
+func TestImportUsersAtomicFailureWritesNothing(t *testing.T) {
+	ctx := context.Background()
+	store := newFailingStore(1)
+	svc := NewService(store, testArgon2id)
+	rows := []ImportRow{
+		{Line: 2, Username: "ana", Email: "ana@exemplo.com", Password: "segredo1"},
+		{Line: 3, Username: "bia", Email: "bia@exemplo.com", Password: "segredo1"},
+	}
+
+	report, err := svc.ImportUsers(ctx, rows, ImportOptions{})
+	if err == nil {
+		t.Fatal("ImportUsers não devolveu erro")
+	}
+	if report.Committed || len(report.Rows) != 0 {
+		t.Errorf("relatório %+v, quer vazio", report)
+	}
+	if _, err := store.GetByUsername(ctx, "ana"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetByUsername(ana): %v, quer ErrNotFound: a transação devia ser desfeita", err)
+	}
+}
+
+func TestImportUsersDryRunIsReadOnly(t *testing.T) {
+	ctx := context.Background()
+	for _, bestEffort := range []bool{false, true} {
+		// Qualquer Create falha: o dry-run não pode tentar gravar.
+		store := newFailingStore(0)
+		svc := NewService(store, testArgon2id)
+		ana := mustCreate(t, store.UserStore, "ana")
+		rows := []ImportRow{
+			{Line: 2, Username: "ana", Email: "nova@exemplo.com", Password: "segredo1"},
+			{Line: 3, Username: "bia", Email: "ana@exemplo.com", Password: "segredo1"},
+			{Line: 4, Username: "caio", Email: "caio@exemplo.com", Password: "segredo1"},
+			{Line: 5, Username: "caio", Email: "outro@exemplo.com", Password: "segredo1"},
+			{Line: 6, Username: "duda", Email: "caio@exemplo.com", Password: "segredo1"},
+			{Line: 7, Username: "edu", Email: "invalido", Password: "segredo1"},
+		}
+
+		report, err := svc.ImportUsers(ctx, rows, ImportOptions{DryRun: true, BestEffort: bestEffort})
+		if err != nil {
+			t.Fatalf("best_effort=%v: ImportUsers: %v", bestEffort, err)
+		}
+		if report.Committed || *store.calls != 0 {
+			t.Errorf("best_effort=%v: committed=%v com %d Create, quer nenhum", bestEffort, report.Committed, *store.calls)
+		}
+		want := []struct{ status, conflict string }{
+			{ImportConflict, "username"},
+			{ImportConflict, "email"},
+			{ImportCreated, ""},
+			{ImportConflict, "username"},
+			{ImportConflict, "email"},
+			{ImportInvalid, ""},
+		}
+		for i, res := range report.Rows {
+			if res.Status != want[i].status || res.Conflict != want[i].conflict || res.ID != 0 {
+				t.Errorf("best_effort=%v: linha %d: status %q, conflito %q, ID %d, quer %q e %q sem ID",
+					bestEffort, res.Line, res.Status, res.Conflict, res.ID, want[i].status, want[i].conflict)
+			}
+		}
+		if report.Created != 1 || report.Conflicts != 4 || report.Invalid != 1 {
+			t.Errorf("best_effort=%v: totais created=%d conflicts=%d invalid=%d, quer 1, 4 e 1",
+				bestEffort, report.Created, report.Conflicts, report.Invalid)
+		}
+
+		// O ID seguinte não foi consumido pelo dry-run.
+		store.failAfter = 1
+		if bia := mustCreate(t, store, "bia"); bia.ID != ana.ID+1 {
+			t.Errorf("best_effort=%v: ID %d depois do dry-run, quer %d", bestEffort, bia.ID, ana.ID+1)
+		}
+	}
+}
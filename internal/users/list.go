@@ -0,0 +1,207 @@
+package users
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Campos aceitos em ListQuery.Sort.
+const (
+	SortByID        = "id"
+	SortByUsername  = "username"
+	SortByCreatedAt = "created_at"
+)
+
+// ListQuery descreve uma página da listagem de utilizadores. Os filtros vazios
+// (ou zero) não se aplicam.
+type ListQuery struct {
+	// Limit é o número máximo de utilizadores devolvidos; 0 devolve todos.
+	Limit int
+	// Sort é SortByID (padrão), SortByUsername ou SortByCreatedAt; o ID
+	// desempata as ordenações por outros campos.
+	Sort string
+	Desc bool
+	// After, se definido, devolve apenas os utilizadores posteriores a esta
+	// posição na ordenação (paginação por keyset).
+	After *Cursor
+
+	// EmailDomain filtra pelo domínio do email ("exemplo.com").
+	EmailDomain string
+	// Status filtra por StatusActive ou StatusDisabled.
+	Status string
+	// Role filtra por RoleAdmin ou RoleUser.
+	Role string
+	// CreatedFrom e CreatedTo limitam created_at ao intervalo [CreatedFrom, CreatedTo).
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+}
+
+// Cursor é a posição do último utilizador de uma página, na ordenação em que
+// foi listado.
+type Cursor struct {
+	Sort      string    `json:"s"`
+	Desc      bool      `json:"d,omitempty"`
+	ID        int64     `json:"i"`
+	Username  string    `json:"u,omitempty"`
+	CreatedAt time.Time `json:"c,omitzero"`
+}
+
+// cursorAfter devolve o Cursor que continua a listagem depois de u.
+func cursorAfter(q ListQuery, u User) *Cursor {
+	c := &Cursor{Sort: q.Sort, Desc: q.Desc, ID: u.ID}
+	switch q.Sort {
+	case SortByUsername:
+		c.Username = u.Username
+	case SortByCreatedAt:
+		c.CreatedAt = u.CreatedAt
+	}
+	return c
+}
+
+// Encode devolve o cursor em texto opaco, seguro para URLs.
+func (c Cursor) Encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeCursor lê um cursor produzido por Cursor.Encode.
+func DecodeCursor(s string) (*Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("cursor inválido: %v", err)
+	}
+	var c Cursor
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("cursor inválido: %v", err)
+	}
+	return &c, nil
+}
+
+// Page é uma página de ListUsers. NextCursor é vazio na última página.
+type Page struct {
+	Users      []User
+	NextCursor string
+}
+
+// validate confere os valores de q e aplica a ordenação padrão.
+func (q *ListQuery) validate() error {
+	verr := &ValidationError{}
+	if q.Sort == "" {
+		q.Sort = SortByID
+	}
+	switch q.Sort {
+	case SortByID, SortByUsername, SortByCreatedAt:
+	default:
+		verr.add("sort", "ordenação inválida; use id, username ou created_at")
+	}
+	if q.Limit < 0 {
+		verr.add("limit", "limite não pode ser negativo")
+	}
+	if q.After != nil && (q.After.Sort != q.Sort || q.After.Desc != q.Desc) {
+		verr.add("cursor", "cursor pertence a outra ordenação")
+	}
+	q.EmailDomain = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(q.EmailDomain), "@"))
+	if strings.ContainsAny(q.EmailDomain, "@%_ ") {
+		verr.add("email_domain", "domínio de email inválido")
+	}
+	if q.Status != "" && q.Status != StatusActive && q.Status != StatusDisabled {
+		verr.add("status", "estado inválido; use active ou disabled")
+	}
+	if q.Role != "" && q.Role != RoleAdmin && q.Role != RoleUser {
+		verr.add("role", "papel inválido; use admin ou user")
+	}
+	if !q.CreatedFrom.IsZero() && !q.CreatedTo.IsZero() && !q.CreatedFrom.Before(q.CreatedTo) {
+		verr.add("created_to", "created_to deve ser posterior a created_from")
+	}
+	return verr.errOrNil()
+}
+
+// ListUsers devolve uma página de utilizadores (sem o hash da senha) segundo
+// q. Valores inválidos em q devolvem um *ValidationError.
+func (s *Service) ListUsers(ctx context.Context, q ListQuery) (Page, error) {
+	if err := q.validate(); err != nil {
+		return Page{}, err
+	}
+
+	limit := q.Limit
+	if limit > 0 {
+		// Um utilizador a mais indica se existe uma próxima página.
+		q.Limit++
+	}
+	list, err := s.Store.List(ctx, q)
+	if err != nil {
+		return Page{}, err
+	}
+
+	page := Page{Users: list}
+	if limit > 0 && len(list) > limit {
+		page.Users = list[:limit]
+		page.NextCursor = cursorAfter(q, list[limit-1]).Encode()
+	}
+	return page, nil
+}
+
+// EachUser chama fn para cada utilizador (sem o hash da senha) que atende a
+// q, sem carregar todos em memória; q.Limit 0 percorre todos. Valores
+// inválidos em q devolvem um *ValidationError.
+func (s *Service) EachUser(ctx context.Context, q ListQuery, fn func(User) error) error {
+	if err := q.validate(); err != nil {
+		return err
+	}
+	return s.Store.Each(ctx, q, func(u User) error {
+		u.PasswordHash = ""
+		return fn(u)
+	})
+}
+
+// matches aplica a um utilizador os filtros e o cursor de q; usado pelo
+// memoryStore, com a mesma semântica das consultas SQL.
+func (q ListQuery) matches(u User) bool {
+	if q.EmailDomain != "" && !strings.HasSuffix(strings.ToLower(u.Email), "@"+q.EmailDomain) {
+		return false
+	}
+	if q.Status != "" && u.Status != q.Status {
+		return false
+	}
+	if q.Role != "" && u.Role != q.Role {
+		return false
+	}
+	if !q.CreatedFrom.IsZero() && u.CreatedAt.Before(q.CreatedFrom) {
+		return false
+	}
+	if !q.CreatedTo.IsZero() && !u.CreatedAt.Before(q.CreatedTo) {
+		return false
+	}
+	if q.After == nil {
+		return true
+	}
+	cmp := q.compare(u, User{ID: q.After.ID, Username: q.After.Username, CreatedAt: q.After.CreatedAt})
+	return cmp > 0
+}
+
+// compare ordena a e b segundo q.Sort e q.Desc, desempatando pelo ID.
+func (q ListQuery) compare(a, b User) int {
+	c := 0
+	switch q.Sort {
+	case SortByUsername:
+		c = strings.Compare(a.Username, b.Username)
+	case SortByCreatedAt:
+		c = a.CreatedAt.Compare(b.CreatedAt)
+	}
+	if c == 0 {
+		switch {
+		case a.ID < b.ID:
+			c = -1
+		case a.ID > b.ID:
+			c = 1
+		}
+	}
+	if q.Desc {
+		return -c
+	}
+	return c
+}
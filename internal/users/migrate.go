@@ -0,0 +1,286 @@
+package users
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migrationsFS guarda os arquivos <versão>_<nome>.up.sql e <versão>_<nome>.down.sql.
+//
+//go:embed migrations/*.sql
+var migrationsFS embed.FS
+
+// migrationLockKey identifica o advisory lock do Postgres que serializa as
+// migrações entre réplicas que iniciam ao mesmo tempo.
+const migrationLockKey int64 = 0x7573756172696f73 // "usuarios"
+
+type migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus descreve uma migração e quando ela foi aplicada (nil se pendente).
+type MigrationStatus struct {
+	Version   int64
+	Name      string
+	AppliedAt *time.Time
+}
+
+// loadMigrations lê as migrações embutidas, ordenadas por versão.
+func loadMigrations() ([]migration, error) {
+	files, err := fs.Glob(migrationsFS, "migrations/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int64]*migration{}
+	for _, file := range files {
+		base := path.Base(file)
+		stem, direction, ok := strings.Cut(strings.TrimSuffix(base, ".sql"), ".")
+		if !ok || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("nome de migração inválido: %s", base)
+		}
+		versionStr, name, _ := strings.Cut(stem, "_")
+		version, err := strconv.ParseInt(versionStr, 10, 64)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("versão de migração inválida: %s", base)
+		}
+
+		body, err := migrationsFS.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		m, exists := byVersion[version]
+		if !exists {
+			m = &migration{Version: version, Name: name}
+			byVersion[version] = m
+		} else if m.Name != name {
+			return nil, fmt.Errorf("versão de migração %d duplicada: %s e %s", version, m.Name, name)
+		}
+		if direction == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migração %d_%s sem arquivo .up.sql", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Migrator aplica e reverte as migrações embutidas no schema do Postgres.
+type Migrator struct {
+	db         *sql.DB
+	migrations []migration
+}
+
+func NewMigrator(db *sql.DB) (*Migrator, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// withLock executa fn numa conexão dedicada que detém o advisory lock das
+// migrações, garantindo que a tabela schema_migrations existe.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("erro ao obter conexão para migrações: %v", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockKey); err != nil {
+		return fmt.Errorf("erro ao obter lock de migrações: %v", err)
+	}
+	defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockKey)
+
+	_, err = conn.ExecContext(ctx, `
+    CREATE TABLE IF NOT EXISTS schema_migrations (
+        version BIGINT PRIMARY KEY,
+        name TEXT NOT NULL,
+        applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+    );`)
+	if err != nil {
+		return fmt.Errorf("erro ao criar a tabela 'schema_migrations': %v", err)
+	}
+
+	return fn(conn)
+}
+
+func appliedMigrations(ctx context.Context, conn *sql.Conn) (map[int64]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("erro ao ler 'schema_migrations': %v", err)
+	}
+	defer rows.Close()
+
+	applied := map[int64]time.Time{}
+	for rows.Next() {
+		var version int64
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, fmt.Errorf("erro ao ler 'schema_migrations': %v", err)
+		}
+		applied[version] = at
+	}
+	return applied, rows.Err()
+}
+
+// runMigration executa o SQL e registra (ou remove) a versão numa única transação.
+func runMigration(ctx context.Context, conn *sql.Conn, m migration, up bool) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if up {
+		_, err = tx.ExecContext(ctx, m.Up)
+		if err == nil {
+			_, err = tx.ExecContext(ctx, "INSERT INTO schema_migrations(version, name) VALUES ($1, $2)", m.Version, m.Name)
+		}
+	} else {
+		_, err = tx.ExecContext(ctx, m.Down)
+		if err == nil {
+			_, err = tx.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = $1", m.Version)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Up aplica, em ordem, todas as migrações pendentes.
+func (m *Migrator) Up(ctx context.Context) (count int, err error) {
+	err = m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, mig := range m.migrations {
+			if _, ok := applied[mig.Version]; ok {
+				continue
+			}
+			start := time.Now()
+			if err := runMigration(ctx, conn, mig, true); err != nil {
+				return fmt.Errorf("erro ao aplicar migração %d_%s: %v", mig.Version, mig.Name, err)
+			}
+			slog.InfoContext(ctx, "Migração aplicada", "version", mig.Version, "name", mig.Name, "duration_ms", time.Since(start).Milliseconds())
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// Down reverte as n migrações aplicadas mais recentes.
+func (m *Migrator) Down(ctx context.Context, n int) (count int, err error) {
+	err = m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for i := len(m.migrations) - 1; i >= 0 && count < n; i-- {
+			mig := m.migrations[i]
+			if _, ok := applied[mig.Version]; !ok {
+				continue
+			}
+			if mig.Down == "" {
+				return fmt.Errorf("migração %d_%s não tem arquivo .down.sql", mig.Version, mig.Name)
+			}
+			start := time.Now()
+			if err := runMigration(ctx, conn, mig, false); err != nil {
+				return fmt.Errorf("erro ao reverter migração %d_%s: %v", mig.Version, mig.Name, err)
+			}
+			slog.InfoContext(ctx, "Migração revertida", "version", mig.Version, "name", mig.Name, "duration_ms", time.Since(start).Milliseconds())
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// Force marca o schema como estando exatamente na versão indicada, sem
+// executar SQL: registra as migrações até ela e remove as posteriores. Serve
+// para adotar um banco criado manualmente ou recuperar de uma migração
+// aplicada à mão.
+func (m *Migrator) Force(ctx context.Context, version int64) error {
+	if version != 0 && !m.known(version) {
+		return fmt.Errorf("versão de migração desconhecida: %d", version)
+	}
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		if _, err := tx.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version > $1", version); err != nil {
+			return err
+		}
+		for _, mig := range m.migrations {
+			if mig.Version > version {
+				break
+			}
+			_, err := tx.ExecContext(ctx, "INSERT INTO schema_migrations(version, name) VALUES ($1, $2) ON CONFLICT (version) DO NOTHING", mig.Version, mig.Name)
+			if err != nil {
+				return err
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		slog.WarnContext(ctx, "Versão do schema forçada", "version", version)
+		return nil
+	})
+}
+
+// Status lista todas as migrações conhecidas e quando cada uma foi aplicada.
+func (m *Migrator) Status(ctx context.Context) (statuses []MigrationStatus, err error) {
+	err = m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, mig := range m.migrations {
+			s := MigrationStatus{Version: mig.Version, Name: mig.Name}
+			if at, ok := applied[mig.Version]; ok {
+				s.AppliedAt = &at
+			}
+			statuses = append(statuses, s)
+		}
+		return nil
+	})
+	return statuses, err
+}
+
+func (m *Migrator) known(version int64) bool {
+	for _, mig := range m.migrations {
+		if mig.Version == version {
+			return true
+		}
+	}
+	return false
+}
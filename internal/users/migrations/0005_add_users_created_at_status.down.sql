@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS users_username_id_idx;
+DROP INDEX IF EXISTS users_created_at_id_idx;
+ALTER TABLE users DROP COLUMN IF EXISTS status;
+ALTER TABLE users DROP COLUMN IF EXISTS created_at;
@@ -0,0 +1,289 @@
+package users
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	AlgorithmArgon2id     = "argon2id"
+	AlgorithmBcrypt       = "bcrypt"
+	AlgorithmLegacySHA256 = "sha256"
+)
+
+var errUnknownHashFormat = errors.New("formato de hash de senha desconhecido")
+
+// PasswordHasher gera e verifica hashes de senha num formato autodescritivo
+// (PHC para argon2id, MCF para bcrypt), que guarda algoritmo e parâmetros junto
+// do próprio hash.
+type PasswordHasher interface {
+	// Algorithm identifica o algoritmo gerado por Hash.
+	Algorithm() string
+	Hash(password string) (string, error)
+	// Verify compara a senha com um hash gerado por este algoritmo em tempo constante.
+	Verify(encoded, password string) (bool, error)
+	// NeedsRehash indica se um hash deste algoritmo usa parâmetros diferentes dos atuais.
+	NeedsRehash(encoded string) bool
+}
+
+// Argon2idHasher implementa PasswordHasher com argon2id no formato PHC:
+// $argon2id$v=19$m=<KiB>,t=<iterações>,p=<paralelismo>$<salt>$<hash>
+type Argon2idHasher struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+func (h Argon2idHasher) Algorithm() string { return AlgorithmArgon2id }
+
+func (h Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("erro ao gerar salt: %v", err)
+	}
+	key := argon2.IDKey([]byte(password), salt, h.Iterations, h.Memory, h.Parallelism, h.KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.Memory, h.Iterations, h.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (h Argon2idHasher) Verify(encoded, password string) (bool, error) {
+	params, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		return false, err
+	}
+	other := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+	return subtle.ConstantTimeCompare(key, other) == 1, nil
+}
+
+func (h Argon2idHasher) NeedsRehash(encoded string) bool {
+	params, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		return true
+	}
+	return params.Memory != h.Memory ||
+		params.Iterations != h.Iterations ||
+		params.Parallelism != h.Parallelism ||
+		uint32(len(salt)) != h.SaltLength ||
+		uint32(len(key)) != h.KeyLength
+}
+
+func decodeArgon2id(encoded string) (Argon2idHasher, []byte, []byte, error) {
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", salt, hash
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != AlgorithmArgon2id {
+		return Argon2idHasher{}, nil, nil, errUnknownHashFormat
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return Argon2idHasher{}, nil, nil, errUnknownHashFormat
+	}
+	if version != argon2.Version {
+		return Argon2idHasher{}, nil, nil, fmt.Errorf("versão de argon2 não suportada: %d", version)
+	}
+
+	var p Argon2idHasher
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism); err != nil {
+		return Argon2idHasher{}, nil, nil, errUnknownHashFormat
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return Argon2idHasher{}, nil, nil, errUnknownHashFormat
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return Argon2idHasher{}, nil, nil, errUnknownHashFormat
+	}
+	p.SaltLength = uint32(len(salt))
+	p.KeyLength = uint32(len(key))
+	return p, salt, key, nil
+}
+
+// BcryptHasher implementa PasswordHasher com bcrypt ($2a$<custo>$...).
+type BcryptHasher struct {
+	Cost int
+}
+
+func (h BcryptHasher) Algorithm() string { return AlgorithmBcrypt }
+
+func (h BcryptHasher) Hash(password string) (string, error) {
+	b, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	if err != nil {
+		return "", fmt.Errorf("erro ao gerar hash bcrypt: %v", err)
+	}
+	return string(b), nil
+}
+
+func (h BcryptHasher) Verify(encoded, password string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (h BcryptHasher) NeedsRehash(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost != h.Cost
+}
+
+// DefaultArgon2id usa 64 MiB, 3 iterações e paralelismo 2.
+var DefaultArgon2id = Argon2idHasher{Memory: 64 * 1024, Iterations: 3, Parallelism: 2, SaltLength: 16, KeyLength: 32}
+
+// PasswordConfig escolhe o algoritmo e os custos dos novos hashes de senha.
+type PasswordConfig struct {
+	// Algorithm é AlgorithmArgon2id (o padrão) ou AlgorithmBcrypt.
+	Algorithm         string
+	Argon2MemoryKiB   int
+	Argon2Iterations  int
+	Argon2Parallelism int
+	BcryptCost        int
+}
+
+// DefaultPasswordConfig usa DefaultArgon2id e bcrypt com custo 12.
+func DefaultPasswordConfig() PasswordConfig {
+	return PasswordConfig{
+		Algorithm:         AlgorithmArgon2id,
+		Argon2MemoryKiB:   int(DefaultArgon2id.Memory),
+		Argon2Iterations:  int(DefaultArgon2id.Iterations),
+		Argon2Parallelism: int(DefaultArgon2id.Parallelism),
+		BcryptCost:        12,
+	}
+}
+
+// maxArgon2MemoryKiB limita a memória de cada hash a 4 GiB.
+const maxArgon2MemoryKiB = 4 << 20
+
+// NewPasswordHasher devolve o hasher descrito por cfg. Custos fora dos
+// limites de cada algoritmo são erros: convertidos para os tipos do argon2,
+// um paralelismo de 256 viraria 0, e o argon2 entra em pânico com ele.
+func NewPasswordHasher(cfg PasswordConfig) (PasswordHasher, error) {
+	var errs []error
+	inRange := func(name string, v, lo, hi int) {
+		if v < lo || v > hi {
+			errs = append(errs, fmt.Errorf("%s deve estar entre %d e %d (recebido %d)", name, lo, hi, v))
+		}
+	}
+	switch cfg.Algorithm {
+	case "", AlgorithmArgon2id:
+		inRange("memória do argon2id (KiB)", cfg.Argon2MemoryKiB, 8*cfg.Argon2Parallelism, maxArgon2MemoryKiB)
+		inRange("iterações do argon2id", cfg.Argon2Iterations, 1, math.MaxInt32)
+		inRange("paralelismo do argon2id", cfg.Argon2Parallelism, 1, math.MaxUint8)
+		if err := errors.Join(errs...); err != nil {
+			return nil, err
+		}
+		return Argon2idHasher{
+			Memory:      uint32(cfg.Argon2MemoryKiB),
+			Iterations:  uint32(cfg.Argon2Iterations),
+			Parallelism: uint8(cfg.Argon2Parallelism),
+			SaltLength:  DefaultArgon2id.SaltLength,
+			KeyLength:   DefaultArgon2id.KeyLength,
+		}, nil
+	case AlgorithmBcrypt:
+		inRange("custo do bcrypt", cfg.BcryptCost, bcrypt.MinCost, bcrypt.MaxCost)
+		if err := errors.Join(errs...); err != nil {
+			return nil, err
+		}
+		return BcryptHasher{Cost: cfg.BcryptCost}, nil
+	default:
+		return nil, fmt.Errorf("algoritmo de hash de senha desconhecido %q (use argon2id ou bcrypt)", cfg.Algorithm)
+	}
+}
+
+// NewPasswordHasherFromEnv lê a PasswordConfig de PASSWORD_HASH_ALGORITHM
+// (argon2id, o padrão, ou bcrypt), ARGON2_MEMORY_KIB, ARGON2_ITERATIONS,
+// ARGON2_PARALLELISM e BCRYPT_COST. Valores inválidos são erros.
+func NewPasswordHasherFromEnv() (PasswordHasher, error) {
+	cfg := DefaultPasswordConfig()
+	if v := os.Getenv("PASSWORD_HASH_ALGORITHM"); v != "" {
+		cfg.Algorithm = v
+	}
+	var errs []error
+	for _, e := range []struct {
+		name string
+		p    *int
+	}{
+		{"ARGON2_MEMORY_KIB", &cfg.Argon2MemoryKiB},
+		{"ARGON2_ITERATIONS", &cfg.Argon2Iterations},
+		{"ARGON2_PARALLELISM", &cfg.Argon2Parallelism},
+		{"BCRYPT_COST", &cfg.BcryptCost},
+	} {
+		v := os.Getenv(e.name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: inteiro inválido %q", e.name, v))
+			continue
+		}
+		*e.p = n
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return NewPasswordHasher(cfg)
+}
+
+// HashAlgorithm identifica o algoritmo de um hash armazenado. Hashes com 64
+// dígitos hexadecimais são os SHA-256 sem salt das versões anteriores.
+func HashAlgorithm(encoded string) string {
+	switch {
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		return AlgorithmArgon2id
+	case strings.HasPrefix(encoded, "$2a$"), strings.HasPrefix(encoded, "$2b$"), strings.HasPrefix(encoded, "$2y$"):
+		return AlgorithmBcrypt
+	case len(encoded) == sha256.Size*2 && isHex(encoded):
+		return AlgorithmLegacySHA256
+	default:
+		return ""
+	}
+}
+
+// VerifyPassword confere a senha contra o hash armazenado, qualquer que seja o
+// algoritmo, sempre em tempo constante. needsRehash indica que a senha confere
+// mas o hash deve ser regravado com o algoritmo e os parâmetros de current.
+func VerifyPassword(current PasswordHasher, encoded, password string) (ok, needsRehash bool, err error) {
+	algo := HashAlgorithm(encoded)
+	switch algo {
+	case AlgorithmArgon2id:
+		ok, err = Argon2idHasher{}.Verify(encoded, password)
+	case AlgorithmBcrypt:
+		ok, err = BcryptHasher{}.Verify(encoded, password)
+	case AlgorithmLegacySHA256:
+		sum := sha256.Sum256([]byte(password))
+		ok = subtle.ConstantTimeCompare([]byte(hex.EncodeToString(sum[:])), []byte(encoded)) == 1
+	default:
+		return false, false, errUnknownHashFormat
+	}
+	if err != nil || !ok {
+		return false, false, err
+	}
+
+	needsRehash = algo != current.Algorithm() || current.NeedsRehash(encoded)
+	return true, needsRehash, nil
+}
+
+func isHex(s string) bool {
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
@@ -0,0 +1,371 @@
+package users
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Custos mínimos, para que os testes não gastem 64 MiB e segundos por hash.
+var (
+	testArgon2id = Argon2idHasher{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+	testBcrypt   = BcryptHasher{Cost: bcrypt.MinCost}
+)
+
+func mustHash(t *testing.T, h PasswordHasher, password string) string {
+	t.Helper()
+	encoded, err := h.Hash(password)
+	if err != nil {
+		t.Fatalf("%s.Hash: %v", h.Algorithm(), err)
+	}
+	return encoded
+}
+
+func legacyHash(password string) string {
+	sum := sha256.Sum256([]byte(password))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestHashAlgorithm(t *testing.T) {
+	tests := []struct {
+		name    string
+		encoded string
+		want    string
+	}{
+		{"argon2id", mustHash(t, testArgon2id, "segredo1"), AlgorithmArgon2id},
+		{"bcrypt 2a", mustHash(t, testBcrypt, "segredo1"), AlgorithmBcrypt},
+		{"bcrypt 2b", "$2b$10$abcdefghijklmnopqrstuu", AlgorithmBcrypt},
+		{"bcrypt 2y", "$2y$10$abcdefghijklmnopqrstuu", AlgorithmBcrypt},
+		{"sha256 legado", legacyHash("segredo1"), AlgorithmLegacySHA256},
+		{"sha256 em maiúsculas", strings.ToUpper(legacyHash("segredo1")), AlgorithmLegacySHA256},
+		{"64 caracteres não hexadecimais", strings.Repeat("z", 64), ""},
+		{"hexadecimal curto", legacyHash("segredo1")[:40], ""},
+		{"vazio", "", ""},
+		{"senha em claro", "segredo1", ""},
+		{"outro PHC", "$scrypt$ln=15,r=8,p=1$c2FsdA$aGFzaA", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HashAlgorithm(tt.encoded); got != tt.want {
+				t.Errorf("HashAlgorithm(%q) = %q, quer %q", tt.encoded, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyPassword(t *testing.T) {
+	const password = "segredo1"
+	argonHash := mustHash(t, testArgon2id, password)
+	bcryptHash := mustHash(t, testBcrypt, password)
+	oldArgon := testArgon2id
+	oldArgon.Iterations = 2
+	oldArgonHash := mustHash(t, oldArgon, password)
+
+	tests := []struct {
+		name            string
+		current         PasswordHasher
+		encoded         string
+		password        string
+		wantOK          bool
+		wantNeedsRehash bool
+	}{
+		{"argon2id correta", testArgon2id, argonHash, password, true, false},
+		{"argon2id errada", testArgon2id, argonHash, "outra123", false, false},
+		{"argon2id com parâmetros antigos", testArgon2id, oldArgonHash, password, true, true},
+		{"argon2id com o bcrypt atual", testBcrypt, argonHash, password, true, true},
+		{"bcrypt correta", testBcrypt, bcryptHash, password, true, false},
+		{"bcrypt errada", testBcrypt, bcryptHash, "outra123", false, false},
+		{"bcrypt com outro custo", BcryptHasher{Cost: bcrypt.MinCost + 1}, bcryptHash, password, true, true},
+		{"bcrypt com o argon2id atual", testArgon2id, bcryptHash, password, true, true},
+		{"sha256 legado correta", testArgon2id, legacyHash(password), password, true, true},
+		{"sha256 legado errada", testArgon2id, legacyHash(password), "outra123", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, needsRehash, err := VerifyPassword(tt.current, tt.encoded, tt.password)
+			if err != nil {
+				t.Fatalf("VerifyPassword: %v", err)
+			}
+			if ok != tt.wantOK || needsRehash != tt.wantNeedsRehash {
+				t.Errorf("VerifyPassword = (%v, %v), quer (%v, %v)", ok, needsRehash, tt.wantOK, tt.wantNeedsRehash)
+			}
+		})
+	}
+}
+
+func TestVerifyPasswordUnknownFormat(t *testing.T) {
+	for _, encoded := range []string{"", "segredo1", "$scrypt$ln=15,r=8,p=1$c2FsdA$aGFzaA"} {
+		ok, needsRehash, err := VerifyPassword(testArgon2id, encoded, "segredo1")
+		if !errors.Is(err, errUnknownHashFormat) || ok || needsRehash {
+			t.Errorf("VerifyPassword(%q) = (%v, %v, %v), quer errUnknownHashFormat", encoded, ok, needsRehash, err)
+		}
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	argonHash := mustHash(t, testArgon2id, "segredo1")
+	bcryptHash := mustHash(t, testBcrypt, "segredo1")
+
+	tests := []struct {
+		name    string
+		hasher  PasswordHasher
+		encoded string
+		want    bool
+	}{
+		{"argon2id com os mesmos parâmetros", testArgon2id, argonHash, false},
+		{"argon2id com mais memória", Argon2idHasher{Memory: 128, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}, argonHash, true},
+		{"argon2id com mais iterações", Argon2idHasher{Memory: 64, Iterations: 2, Parallelism: 1, SaltLength: 16, KeyLength: 32}, argonHash, true},
+		{"argon2id com mais paralelismo", Argon2idHasher{Memory: 64, Iterations: 1, Parallelism: 2, SaltLength: 16, KeyLength: 32}, argonHash, true},
+		{"argon2id com salt maior", Argon2idHasher{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 32, KeyLength: 32}, argonHash, true},
+		{"argon2id com chave maior", Argon2idHasher{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 64}, argonHash, true},
+		{"argon2id ilegível", testArgon2id, "$argon2id$v=19$lixo", true},
+		{"bcrypt com o mesmo custo", testBcrypt, bcryptHash, false},
+		{"bcrypt com outro custo", BcryptHasher{Cost: bcrypt.MinCost + 1}, bcryptHash, true},
+		{"bcrypt ilegível", testBcrypt, "$2a$lixo", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.hasher.NeedsRehash(tt.encoded); got != tt.want {
+				t.Errorf("NeedsRehash = %v, quer %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeArgon2idBadInput(t *testing.T) {
+	valid := mustHash(t, testArgon2id, "segredo1")
+	parts := strings.Split(valid, "$")
+	with := func(i int, v string) string {
+		p := append([]string(nil), parts...)
+		p[i] = v
+		return strings.Join(p, "$")
+	}
+
+	if _, _, _, err := decodeArgon2id(valid); err != nil {
+		t.Fatalf("decodeArgon2id(%q): %v", valid, err)
+	}
+	tests := map[string]string{
+		"vazio":                 "",
+		"poucas partes":         "$argon2id$v=19$m=64,t=1,p=1$c2FsdA",
+		"partes a mais":         valid + "$extra",
+		"outro algoritmo":       with(1, "argon2i"),
+		"versão ilegível":       with(2, "v=x"),
+		"versão não suportada":  with(2, "v=16"),
+		"parâmetros ilegíveis":  with(3, "m=64;t=1;p=1"),
+		"parâmetros ausentes":   with(3, ""),
+		"paralelismo excessivo": with(3, "m=64,t=1,p=256"),
+		"salt fora de base64":   with(4, "!!!"),
+		"hash fora de base64":   with(5, "!!!"),
+		"hash vazio":            with(5, ""),
+	}
+	for name, encoded := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, _, _, err := decodeArgon2id(encoded); err == nil {
+				t.Fatalf("decodeArgon2id(%q) não devolveu erro", encoded)
+			}
+			// Um hash corrompido no banco nunca pode autenticar.
+			if ok, err := (Argon2idHasher{}).Verify(encoded, "segredo1"); ok || err == nil {
+				t.Errorf("Verify(%q) = (%v, %v), quer erro", encoded, ok, err)
+			}
+		})
+	}
+}
+
+func TestValidateRegistrationPassword(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		wantErr  bool
+	}{
+		{"no limite", strings.Repeat("a", MaxPasswordBytes), false},
+		{"acima do limite", strings.Repeat("a", MaxPasswordBytes+1), true},
+		// O limite é em bytes: 37 "ç" ocupam 74.
+		{"multibyte acima do limite", strings.Repeat("ç", 37), true},
+		{"curta", "abc", true},
+		{"vazia", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateRegistration("ana", "ana@exemplo.com", tt.password); (err != nil) != tt.wantErr {
+				t.Errorf("validateRegistration: erro %v, quer erro: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNormalizePassword(t *testing.T) {
+	for _, password := range []string{" segredo1 ", "segredo1", "\tsegredo1\n"} {
+		if got := normalizePassword(password); got != "segredo1" {
+			t.Errorf("normalizePassword(%q) = %q, quer %q", password, got, "segredo1")
+		}
+	}
+}
+
+func TestRegisterUserPasswordLength(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		wantErr  bool
+	}{
+		{"no limite", strings.Repeat("a", MaxPasswordBytes), false},
+		{"acima do limite", strings.Repeat("a", MaxPasswordBytes+1), true},
+		// O limite é em bytes: 37 "ç" ocupam 74.
+		{"multibyte acima do limite", strings.Repeat("ç", 37), true},
+		{"curta", "abc", true},
+	}
+	for _, hasher := range []PasswordHasher{testBcrypt, testArgon2id} {
+		for _, tt := range tests {
+			t.Run(hasher.Algorithm()+"/"+tt.name, func(t *testing.T) {
+				svc := NewService(NewMemoryStore(), hasher)
+				_, err := svc.RegisterUser(context.Background(), "ana", "ana@exemplo.com", tt.password)
+				if tt.wantErr && !errors.Is(err, ErrValidation) {
+					t.Fatalf("RegisterUser: erro %v, quer ErrValidation", err)
+				}
+				if !tt.wantErr && err != nil {
+					t.Fatalf("RegisterUser: %v", err)
+				}
+			})
+		}
+	}
+}
+
+func TestPasswordNormalization(t *testing.T) {
+	ctx := context.Background()
+	svc := NewService(NewMemoryStore(), testArgon2id)
+	user, err := svc.RegisterUser(ctx, "ana", "ana@exemplo.com", " segredo1 ")
+	if err != nil {
+		t.Fatalf("RegisterUser: %v", err)
+	}
+	for _, password := range []string{" segredo1 ", "segredo1", "\tsegredo1\n"} {
+		if _, err := svc.AuthenticateUser(ctx, "ana", password); err != nil {
+			t.Errorf("AuthenticateUser(%q): %v", password, err)
+		}
+	}
+	if _, err := svc.AuthenticateUser(ctx, "ana", "segredo"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("AuthenticateUser com senha errada: %v, quer ErrInvalidCredentials", err)
+	}
+	if err := svc.ChangePassword(ctx, user.ID, 0, " segredo1 ", " novasenha "); err != nil {
+		t.Fatalf("ChangePassword: %v", err)
+	}
+	if _, err := svc.AuthenticateUser(ctx, "ana", "novasenha"); err != nil {
+		t.Errorf("AuthenticateUser após ChangePassword: %v", err)
+	}
+}
+
+func TestAuthenticateUserUpgradesLegacyHash(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	created, err := store.Create(ctx, User{Username: "ana", Email: "ana@exemplo.com", PasswordHash: legacyHash("segredo1")})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	var upgradedFrom string
+	svc := NewService(store, testArgon2id)
+	svc.OnRehash = func(_ context.Context, _ User, from, _ string, err error) {
+		if err != nil {
+			t.Errorf("OnRehash: %v", err)
+		}
+		upgradedFrom = from
+	}
+	if _, err := svc.AuthenticateUser(ctx, "ana", "segredo1"); err != nil {
+		t.Fatalf("AuthenticateUser: %v", err)
+	}
+	if upgradedFrom != AlgorithmLegacySHA256 {
+		t.Errorf("hash regravado a partir de %q, quer %q", upgradedFrom, AlgorithmLegacySHA256)
+	}
+	stored, err := store.GetByID(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if got := HashAlgorithm(stored.PasswordHash); got != AlgorithmArgon2id {
+		t.Errorf("hash gravado com %q, quer %q", got, AlgorithmArgon2id)
+	}
+}
+
+func TestNewPasswordHasher(t *testing.T) {
+	with := func(change func(*PasswordConfig)) PasswordConfig {
+		cfg := DefaultPasswordConfig()
+		change(&cfg)
+		return cfg
+	}
+	tests := []struct {
+		name    string
+		cfg     PasswordConfig
+		want    PasswordHasher
+		wantErr bool
+	}{
+		{"padrão", DefaultPasswordConfig(), DefaultArgon2id, false},
+		{"algoritmo vazio", with(func(c *PasswordConfig) { c.Algorithm = "" }), DefaultArgon2id, false},
+		{"bcrypt", with(func(c *PasswordConfig) { c.Algorithm = AlgorithmBcrypt }), BcryptHasher{Cost: 12}, false},
+		{"paralelismo máximo", with(func(c *PasswordConfig) { c.Argon2Parallelism = 255; c.Argon2MemoryKiB = 8 * 255 }),
+			Argon2idHasher{Memory: 8 * 255, Iterations: 3, Parallelism: 255, SaltLength: 16, KeyLength: 32}, false},
+		// Convertido para uint8, 256 viraria 0 e o argon2 entraria em pânico.
+		{"paralelismo 256", with(func(c *PasswordConfig) { c.Argon2Parallelism = 256 }), nil, true},
+		{"paralelismo zero", with(func(c *PasswordConfig) { c.Argon2Parallelism = 0 }), nil, true},
+		{"paralelismo negativo", with(func(c *PasswordConfig) { c.Argon2Parallelism = -1 }), nil, true},
+		{"memória abaixo de 8 KiB por via", with(func(c *PasswordConfig) { c.Argon2MemoryKiB = 15 }), nil, true},
+		{"memória acima de 4 GiB", with(func(c *PasswordConfig) { c.Argon2MemoryKiB = 4<<20 + 1 }), nil, true},
+		{"iterações zero", with(func(c *PasswordConfig) { c.Argon2Iterations = 0 }), nil, true},
+		{"custo do bcrypt acima do máximo", with(func(c *PasswordConfig) { c.Algorithm = AlgorithmBcrypt; c.BcryptCost = bcrypt.MaxCost + 1 }), nil, true},
+		{"custo do bcrypt abaixo do mínimo", with(func(c *PasswordConfig) { c.Algorithm = AlgorithmBcrypt; c.BcryptCost = bcrypt.MinCost - 1 }), nil, true},
+		// Os custos do algoritmo não escolhido não importam.
+		{"bcrypt ignora o argon2id", with(func(c *PasswordConfig) { c.Algorithm = AlgorithmBcrypt; c.Argon2Parallelism = 0 }), BcryptHasher{Cost: 12}, false},
+		{"algoritmo desconhecido", with(func(c *PasswordConfig) { c.Algorithm = "scrypt" }), nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewPasswordHasher(tt.cfg)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("NewPasswordHasher(%+v) = %+v, quer erro", tt.cfg, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewPasswordHasher(%+v): %v", tt.cfg, err)
+			}
+			if got != tt.want {
+				t.Errorf("NewPasswordHasher(%+v) = %+v, quer %+v", tt.cfg, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewPasswordHasherFromEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    PasswordHasher
+		wantErr bool
+	}{
+		{"sem variáveis", nil, DefaultArgon2id, false},
+		{"bcrypt", map[string]string{"PASSWORD_HASH_ALGORITHM": "bcrypt", "BCRYPT_COST": "10"}, BcryptHasher{Cost: 10}, false},
+		{"argon2id", map[string]string{"ARGON2_MEMORY_KIB": "1024", "ARGON2_ITERATIONS": "2", "ARGON2_PARALLELISM": "4"},
+			Argon2idHasher{Memory: 1024, Iterations: 2, Parallelism: 4, SaltLength: 16, KeyLength: 32}, false},
+		{"paralelismo 256", map[string]string{"ARGON2_PARALLELISM": "256"}, nil, true},
+		{"paralelismo negativo", map[string]string{"ARGON2_PARALLELISM": "-1"}, nil, true},
+		{"memória não numérica", map[string]string{"ARGON2_MEMORY_KIB": "64MiB"}, nil, true},
+		{"custo do bcrypt 40", map[string]string{"PASSWORD_HASH_ALGORITHM": "bcrypt", "BCRYPT_COST": "40"}, nil, true},
+		{"algoritmo desconhecido", map[string]string{"PASSWORD_HASH_ALGORITHM": "md5"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range []string{"PASSWORD_HASH_ALGORITHM", "ARGON2_MEMORY_KIB", "ARGON2_ITERATIONS", "ARGON2_PARALLELISM", "BCRYPT_COST"} {
+				t.Setenv(name, tt.env[name])
+			}
+			got, err := NewPasswordHasherFromEnv()
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("NewPasswordHasherFromEnv() = (%+v, %v), quer erro: %v", got, err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("NewPasswordHasherFromEnv() = %+v, quer %+v", got, tt.want)
+			}
+		})
+	}
+}
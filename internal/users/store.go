@@ -0,0 +1,103 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Erros devolvidos por todas as implementações de UserStore e SessionStore.
+var (
+	ErrNotFound          = errors.New("utilizador não encontrado")
+	ErrSessionNotFound   = errors.New("sessão não encontrada")
+	ErrUsernameTaken     = errors.New("nome de utilizador já existe")
+	ErrEmailTaken        = errors.New("email já registado")
+	ErrVersionConflict   = errors.New("utilizador alterado por outra requisição")
+	ErrUsersTableMissing = errors.New("tabela 'users' não existe")
+)
+
+// UserStore persiste os utilizadores. GetByID e GetByUsername devolvem também
+// o PasswordHash; List e SearchByUsername não.
+type UserStore interface {
+	Create(ctx context.Context, u User) (User, error)
+	GetByID(ctx context.Context, id int64) (User, error)
+	GetByUsername(ctx context.Context, username string) (User, error)
+	GetByEmail(ctx context.Context, email string) (User, error)
+	SearchByUsername(ctx context.Context, partial string) ([]User, error)
+	// List devolve os utilizadores que atendem aos filtros de q, na ordem e a
+	// partir do cursor pedidos, até q.Limit (0 devolve todos).
+	List(ctx context.Context, q ListQuery) ([]User, error)
+	// Each chama fn para cada utilizador que List devolveria, sem carregar
+	// todos em memória; um erro de fn interrompe a leitura e é devolvido. fn
+	// pode usar o Store: no SQLite a leitura é feita em páginas e a conexão
+	// não fica presa entre elas.
+	Each(ctx context.Context, q ListQuery, fn func(User) error) error
+	// Update grava username, email, papel, estado e hash da senha do utilizador u.ID,
+	// incrementa a versão e atualiza UpdatedAt. Se u.Version não for 0 e a
+	// versão gravada for outra, nada muda e devolve ErrVersionConflict.
+	Update(ctx context.Context, u User) (User, error)
+	// Delete remove o utilizador id; version diferente de 0 tem o mesmo efeito
+	// que em Update.
+	Delete(ctx context.Context, id, version int64) error
+	// WithTx chama fn com um UserStore cujas operações formam uma única
+	// transação: confirmada se fn devolver nil, desfeita caso contrário.
+	WithTx(ctx context.Context, fn func(UserStore) error) error
+}
+
+// Session é uma sessão do cookie ou um refresh token emitido no login.
+type Session struct {
+	ID        string
+	UserID    int64
+	Kind      string
+	ExpiresAt time.Time
+}
+
+// SessionStore persiste as sessões e refresh tokens ativos.
+type SessionStore interface {
+	CreateSession(ctx context.Context, s Session) error
+	// GetSessionUser devolve o dono de uma sessão ainda válida em now.
+	GetSessionUser(ctx context.Context, id, kind string, now time.Time) (User, error)
+	// DeleteSession remove uma sessão ainda válida em now e informa se ela existia.
+	DeleteSession(ctx context.Context, id, kind string, now time.Time) (bool, error)
+}
+
+// IdempotencyRecord é a resposta guardada para uma Idempotency-Key. Status 0
+// indica que a requisição original ainda está em andamento.
+type IdempotencyRecord struct {
+	Key string
+	// Fingerprint identifica o corpo da requisição original.
+	Fingerprint string
+	Status      int
+	ContentType string
+	Body        []byte
+	ExpiresAt   time.Time
+}
+
+// IdempotencyStore persiste as respostas das requisições com Idempotency-Key.
+type IdempotencyStore interface {
+	// ReserveIdempotencyKey grava rec, com Status 0, se rec.Key não existir ou
+	// tiver expirado em now, e devolve reserved true. Senão devolve o registo
+	// existente. A reserva é atómica: entre requisições simultâneas com a mesma
+	// chave só uma a obtém.
+	ReserveIdempotencyKey(ctx context.Context, rec IdempotencyRecord, now time.Time) (existing IdempotencyRecord, reserved bool, err error)
+	// CompleteIdempotencyKey grava a resposta e a nova expiração de rec.Key.
+	CompleteIdempotencyKey(ctx context.Context, rec IdempotencyRecord) error
+	// DeleteIdempotencyKey libera a chave para uma nova tentativa.
+	DeleteIdempotencyKey(ctx context.Context, key string) error
+	// DeleteExpiredIdempotencyKeys remove os registos expirados em now e
+	// devolve quantos removeu.
+	DeleteExpiredIdempotencyKeys(ctx context.Context, now time.Time) (int64, error)
+}
+
+// Store reúne a persistência usada pelo servidor e as verificações de saúde.
+type Store interface {
+	UserStore
+	SessionStore
+	IdempotencyStore
+	// Backend identifica a implementação ("postgres", "sqlite" ou "memory").
+	Backend() string
+	Ping(ctx context.Context) error
+	// CheckSchema confirma que a tabela users existe.
+	CheckSchema(ctx context.Context) error
+	Close() error
+}
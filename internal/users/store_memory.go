@@ -0,0 +1,304 @@
+package users
+
+import (
+	"cmp"
+	"context"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memoryStore guarda utilizadores e sessões apenas em memória. Serve para
+// desenvolvimento sem banco de dados e para testes; tudo se perde ao reiniciar.
+type memoryStore struct {
+	mu       sync.RWMutex
+	nextID   int64
+	users    map[int64]User
+	sessions map[string]Session
+	idem     map[string]IdempotencyRecord
+}
+
+// NewMemoryStore cria um Store vazio em memória.
+func NewMemoryStore() Store {
+	return &memoryStore{
+		nextID:   1,
+		users:    map[int64]User{},
+		sessions: map[string]Session{},
+		idem:     map[string]IdempotencyRecord{},
+	}
+}
+
+func (s *memoryStore) Backend() string { return "memory" }
+
+func (s *memoryStore) Ping(context.Context) error { return nil }
+
+func (s *memoryStore) CheckSchema(context.Context) error { return nil }
+
+func (s *memoryStore) Close() error { return nil }
+
+// WithTx aplica fn sobre uma cópia dos dados e a adota se fn tiver sucesso.
+// As demais operações esperam até lá.
+func (s *memoryStore) WithTx(_ context.Context, fn func(UserStore) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx := &memoryStore{
+		nextID:   s.nextID,
+		users:    maps.Clone(s.users),
+		sessions: maps.Clone(s.sessions),
+		idem:     maps.Clone(s.idem),
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	s.nextID, s.users, s.sessions, s.idem = tx.nextID, tx.users, tx.sessions, tx.idem
+	return nil
+}
+
+// conflict verifica as restrições UNIQUE de username e email, ignorando o
+// próprio utilizador numa atualização. Chamar com s.mu travado.
+func (s *memoryStore) conflict(u User) error {
+	for id, other := range s.users {
+		if id == u.ID {
+			continue
+		}
+		if other.Username == u.Username {
+			return ErrUsernameTaken
+		}
+		if other.Email == u.Email {
+			return ErrEmailTaken
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) Create(_ context.Context, u User) (User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u.ID = 0
+	if err := s.conflict(u); err != nil {
+		return User{}, err
+	}
+	if u.Role == "" {
+		u.Role = RoleUser
+	}
+	if u.Status == "" {
+		u.Status = StatusActive
+	}
+	u.ID = s.nextID
+	u.Version = 1
+	u.CreatedAt = time.Now().UTC()
+	u.UpdatedAt = u.CreatedAt
+	s.nextID++
+	s.users[u.ID] = u
+
+	u.PasswordHash = ""
+	return u, nil
+}
+
+func (s *memoryStore) GetByID(_ context.Context, id int64) (User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	u, ok := s.users[id]
+	if !ok {
+		return User{}, ErrNotFound
+	}
+	return u, nil
+}
+
+func (s *memoryStore) GetByUsername(_ context.Context, username string) (User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, u := range s.users {
+		if u.Username == username {
+			return u, nil
+		}
+	}
+	return User{}, ErrNotFound
+}
+
+func (s *memoryStore) GetByEmail(_ context.Context, email string) (User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, u := range s.users {
+		if u.Email == email {
+			return u, nil
+		}
+	}
+	return User{}, ErrNotFound
+}
+
+func (s *memoryStore) SearchByUsername(_ context.Context, partial string) ([]User, error) {
+	partial = strings.ToLower(partial)
+	return s.filter(func(u User) bool {
+		return strings.Contains(strings.ToLower(u.Username), partial)
+	}), nil
+}
+
+func (s *memoryStore) List(_ context.Context, q ListQuery) ([]User, error) {
+	users := s.filter(q.matches)
+	slices.SortFunc(users, q.compare)
+	if q.Limit > 0 && len(users) > q.Limit {
+		users = users[:q.Limit]
+	}
+	return users, nil
+}
+
+func (s *memoryStore) Each(ctx context.Context, q ListQuery, fn func(User) error) error {
+	users, _ := s.List(ctx, q)
+	for _, u := range users {
+		if err := fn(u); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// filter devolve, ordenados por ID e sem o hash da senha, os utilizadores
+// aceitos por keep.
+func (s *memoryStore) filter(keep func(User) bool) []User {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var users []User
+	for _, u := range s.users {
+		if keep(u) {
+			u.PasswordHash = ""
+			users = append(users, u)
+		}
+	}
+	slices.SortFunc(users, func(a, b User) int { return cmp.Compare(a.ID, b.ID) })
+	return users
+}
+
+func (s *memoryStore) Update(_ context.Context, u User) (User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.users[u.ID]
+	if !ok {
+		return User{}, ErrNotFound
+	}
+	if u.Version != 0 && u.Version != current.Version {
+		return User{}, ErrVersionConflict
+	}
+	if err := s.conflict(u); err != nil {
+		return User{}, err
+	}
+	u.Version = current.Version + 1
+	u.CreatedAt = current.CreatedAt
+	u.UpdatedAt = time.Now().UTC()
+	s.users[u.ID] = u
+
+	u.PasswordHash = ""
+	return u, nil
+}
+
+func (s *memoryStore) Delete(_ context.Context, id, version int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if version != 0 && version != current.Version {
+		return ErrVersionConflict
+	}
+	delete(s.users, id)
+	for sid, sess := range s.sessions {
+		if sess.UserID == id {
+			delete(s.sessions, sid)
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) CreateSession(_ context.Context, sess Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sessions[sess.ID] = sess
+	return nil
+}
+
+func (s *memoryStore) GetSessionUser(_ context.Context, id, kind string, now time.Time) (User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sess, ok := s.sessions[id]
+	if !ok || sess.Kind != kind || !sess.ExpiresAt.After(now) {
+		return User{}, ErrSessionNotFound
+	}
+	u, ok := s.users[sess.UserID]
+	if !ok || u.Status != StatusActive {
+		return User{}, ErrSessionNotFound
+	}
+	u.PasswordHash = ""
+	return u, nil
+}
+
+func (s *memoryStore) DeleteSession(_ context.Context, id, kind string, now time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.sessions[id]
+	if !ok || sess.Kind != kind || !sess.ExpiresAt.After(now) {
+		return false, nil
+	}
+	delete(s.sessions, id)
+	return true, nil
+}
+
+func (s *memoryStore) ReserveIdempotencyKey(_ context.Context, rec IdempotencyRecord, now time.Time) (IdempotencyRecord, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, ok := s.idem[rec.Key]; ok && existing.ExpiresAt.After(now) {
+		return existing, false, nil
+	}
+	rec.Status, rec.ContentType, rec.Body = 0, "", nil
+	s.idem[rec.Key] = rec
+	return IdempotencyRecord{}, true, nil
+}
+
+func (s *memoryStore) CompleteIdempotencyKey(_ context.Context, rec IdempotencyRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.idem[rec.Key]
+	if !ok {
+		return ErrNotFound
+	}
+	existing.Status, existing.ContentType, existing.Body, existing.ExpiresAt = rec.Status, rec.ContentType, rec.Body, rec.ExpiresAt
+	s.idem[rec.Key] = existing
+	return nil
+}
+
+func (s *memoryStore) DeleteIdempotencyKey(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.idem, key)
+	return nil
+}
+
+func (s *memoryStore) DeleteExpiredIdempotencyKeys(_ context.Context, now time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deleted int64
+	for key, rec := range s.idem {
+		if !rec.ExpiresAt.After(now) {
+			delete(s.idem, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
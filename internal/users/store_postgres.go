@@ -0,0 +1,55 @@
+package users
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/lib/pq"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+var postgresDialect = sqlDialect{
+	name:        "postgres",
+	system:      semconv.DBSystemPostgreSQL,
+	like:        "ILIKE",
+	schemaCheck: "SELECT to_regclass('users') IS NOT NULL",
+	rebind:      func(query string) string { return query },
+	timeArg:     func(t time.Time) any { return t },
+	uniqueColumn: func(err error) (string, bool) {
+		var pgErr *pq.Error
+		if !errors.As(err, &pgErr) || pgErr.Code != "23505" {
+			return "", false
+		}
+		switch pgErr.Constraint {
+		case "users_username_key":
+			return "username", true
+		case "users_email_key":
+			return "email", true
+		}
+		return "", false
+	},
+}
+
+// OpenPostgres abre o pool do Postgres com connector (ver
+// NewPostgresConnector) e confirma a conexão. O schema é gerido pelas
+// migrações (ver Migrator).
+func OpenPostgres(ctx context.Context, connector driver.Connector) (*sql.DB, error) {
+	db := sql.OpenDB(connector)
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("erro ao conectar ao banco de dados (Ping falhou); verifique sua string de conexão e se o servidor PostgreSQL está acessível: %v", RedactDSN(err.Error()))
+	}
+
+	slog.Info("Banco de dados PostgreSQL conectado.")
+	return db, nil
+}
+
+// NewPostgresStore usa um pool aberto por OpenPostgres; Close fecha o pool.
+func NewPostgresStore(db *sql.DB) Store {
+	return &sqlStore{db: db, dialect: postgresDialect}
+}
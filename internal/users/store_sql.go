@@ -0,0 +1,618 @@
+package users
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// sqlDialect isola o que muda entre os bancos SQL suportados.
+type sqlDialect struct {
+	name   string
+	system attribute.KeyValue
+	// like é o operador de busca parcial sem distinção de maiúsculas.
+	like string
+	// schemaCheck devolve true quando a tabela users existe.
+	schemaCheck string
+	// rebind converte os placeholders $N para a sintaxe do driver.
+	rebind func(query string) string
+	// timeArg converte instantes para o tipo gravado em sessions.expires_at.
+	timeArg func(t time.Time) any
+	// uniqueColumn devolve a coluna de users cuja restrição UNIQUE foi violada.
+	uniqueColumn func(err error) (string, bool)
+	// eachPageSize, se maior que 0, faz Each ler em páginas desse tamanho e
+	// fechar a consulta antes de chamar fn com cada uma.
+	eachPageSize int
+}
+
+// sqlStore implementa Store sobre database/sql; Postgres e SQLite diferem
+// apenas no sqlDialect.
+type sqlStore struct {
+	db *sql.DB
+	// tx, se definido, recebe todas as consultas; ver WithTx.
+	tx      *sql.Tx
+	dialect sqlDialect
+}
+
+// sqlConn é o que sqlStore usa de *sql.DB e *sql.Tx.
+type sqlConn interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// conn devolve a transação em curso ou, fora de WithTx, o pool.
+func (s *sqlStore) conn() sqlConn {
+	if s.tx != nil {
+		return s.tx
+	}
+	return s.db
+}
+
+func (s *sqlStore) Backend() string { return s.dialect.name }
+
+func (s *sqlStore) Ping(ctx context.Context) error { return s.db.PingContext(ctx) }
+
+func (s *sqlStore) Close() error { return s.db.Close() }
+
+// Stats expõe as estatísticas do pool de conexões.
+func (s *sqlStore) Stats() sql.DBStats { return s.db.Stats() }
+
+func (s *sqlStore) CheckSchema(ctx context.Context) error {
+	var exists bool
+	if err := s.conn().QueryRowContext(ctx, s.dialect.schemaCheck).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return ErrUsersTableMissing
+	}
+	return nil
+}
+
+func (s *sqlStore) WithTx(ctx context.Context, fn func(UserStore) error) error {
+	if s.tx != nil {
+		return fn(s)
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("erro ao iniciar transação: %v", err)
+	}
+	if err := fn(&sqlStore{db: s.db, tx: tx, dialect: s.dialect}); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("erro ao confirmar transação: %v", err)
+	}
+	return nil
+}
+
+func (s *sqlStore) startSpan(ctx context.Context, operation, table, statement string) (context.Context, func(rows int64, err error)) {
+	ctx, span := startDBSpan(ctx, s.dialect.system, operation, table, statement)
+	return ctx, func(rows int64, err error) { endDBSpan(span, rows, err) }
+}
+
+// translate converte violações de UNIQUE nos erros de duplicidade do Store.
+func (s *sqlStore) translate(err error) error {
+	column, ok := s.dialect.uniqueColumn(err)
+	if !ok {
+		return err
+	}
+	switch column {
+	case "username":
+		return ErrUsernameTaken
+	case "email":
+		return ErrEmailTaken
+	}
+	return err
+}
+
+// userColumns são as colunas de users devolvidas pelas consultas, na ordem de scanUser.
+const userColumns = "id, username, email, role, status, version, created_at, updated_at"
+
+// scanUser lê as userColumns de uma linha, seguidas de extra.
+func scanUser(row interface{ Scan(...any) error }, u *User, extra ...any) error {
+	dest := []any{&u.ID, &u.Username, &u.Email, &u.Role, &u.Status, &u.Version, dbTime{&u.CreatedAt}, dbTime{&u.UpdatedAt}}
+	return row.Scan(append(dest, extra...)...)
+}
+
+// dbTime lê instantes gravados como timestamp (Postgres) ou em nanossegundos
+// Unix (SQLite, ver sqlDialect.timeArg). Zero é lido como o instante zero.
+type dbTime struct{ t *time.Time }
+
+func (d dbTime) Scan(src any) error {
+	switch v := src.(type) {
+	case time.Time:
+		*d.t = v
+	case int64:
+		*d.t = time.Time{}
+		if v != 0 {
+			*d.t = time.Unix(0, v).UTC()
+		}
+	case nil:
+		*d.t = time.Time{}
+	default:
+		return fmt.Errorf("tipo de instante não suportado: %T", src)
+	}
+	return nil
+}
+
+// dbNow devolve o instante atual na precisão de microssegundos do Postgres,
+// para que o valor devolvido seja igual ao gravado.
+func dbNow() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+// Create usa ON CONFLICT DO NOTHING em vez de deixar a restrição UNIQUE
+// falhar: no Postgres o erro abortaria a transação de WithTx inteira, e a
+// importação precisa continuar para relatar as linhas seguintes.
+func (s *sqlStore) Create(ctx context.Context, u User) (created User, err error) {
+	insertSQL := `INSERT INTO users(username, email, password_hash, role, status, created_at, updated_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $6) ON CONFLICT DO NOTHING RETURNING id, version`
+	if u.Role == "" {
+		u.Role = RoleUser
+	}
+	if u.Status == "" {
+		u.Status = StatusActive
+	}
+	u.CreatedAt = dbNow()
+	u.UpdatedAt = u.CreatedAt
+
+	var found int64
+	ctx, end := s.startSpan(ctx, "INSERT", "users", insertSQL)
+	defer func() { end(found, err) }()
+
+	err = s.conn().QueryRowContext(ctx, s.dialect.rebind(insertSQL),
+		u.Username, u.Email, u.PasswordHash, u.Role, u.Status, s.dialect.timeArg(u.CreatedAt)).Scan(&u.ID, &u.Version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, s.takenColumn(ctx, u.Username, u.Email)
+	}
+	if err != nil {
+		if dup := s.translate(err); dup != err {
+			return User{}, dup
+		}
+		return User{}, fmt.Errorf("erro ao inserir utilizador: %v", err)
+	}
+	found = 1
+	u.PasswordHash = ""
+	return u, nil
+}
+
+// takenColumn explica por que o INSERT de Create não gravou a linha: o
+// username (ErrUsernameTaken) ou o email (ErrEmailTaken) já existe.
+func (s *sqlStore) takenColumn(ctx context.Context, username, email string) error {
+	querySQL := "SELECT username = $1 FROM users WHERE username = $1 OR email = $2 ORDER BY username = $1 DESC LIMIT 1"
+
+	var usernameTaken bool
+	err := s.conn().QueryRowContext(ctx, s.dialect.rebind(querySQL), username, email).Scan(&usernameTaken)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return fmt.Errorf("erro ao inserir utilizador: conflito com um registo já removido")
+	case err != nil:
+		return fmt.Errorf("erro ao verificar conflito ao inserir utilizador: %v", err)
+	case usernameTaken:
+		return ErrUsernameTaken
+	default:
+		return ErrEmailTaken
+	}
+}
+
+func (s *sqlStore) getUser(ctx context.Context, where string, arg any) (user User, err error) {
+	querySQL := "SELECT " + userColumns + ", password_hash FROM users WHERE " + where + " = $1"
+
+	var found int64
+	ctx, end := s.startSpan(ctx, "SELECT", "users", querySQL)
+	defer func() { end(found, err) }()
+
+	err = scanUser(s.conn().QueryRowContext(ctx, s.dialect.rebind(querySQL), arg), &user, &user.PasswordHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, ErrNotFound
+	}
+	if err != nil {
+		return User{}, fmt.Errorf("erro ao buscar utilizador por %s: %v", where, err)
+	}
+	found = 1
+	return user, nil
+}
+
+func (s *sqlStore) GetByID(ctx context.Context, id int64) (User, error) {
+	return s.getUser(ctx, "id", id)
+}
+
+func (s *sqlStore) GetByUsername(ctx context.Context, username string) (User, error) {
+	return s.getUser(ctx, "username", username)
+}
+
+func (s *sqlStore) GetByEmail(ctx context.Context, email string) (User, error) {
+	return s.getUser(ctx, "email", email)
+}
+
+func (s *sqlStore) SearchByUsername(ctx context.Context, partial string) ([]User, error) {
+	querySQL := "SELECT " + userColumns + " FROM users WHERE username " + s.dialect.like + " $1 ORDER BY id"
+	users, err := s.queryUsers(ctx, querySQL, "%"+strings.ToLower(partial)+"%")
+	if err != nil {
+		return nil, fmt.Errorf("erro ao buscar utilizadores por nome: %v", err)
+	}
+	return users, nil
+}
+
+func (s *sqlStore) List(ctx context.Context, q ListQuery) ([]User, error) {
+	querySQL, args := s.listSQL(q)
+	users, err := s.queryUsers(ctx, querySQL, args...)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao buscar utilizadores: %v", err)
+	}
+	return users, nil
+}
+
+// Each percorre as linhas sem as acumular ou, com dialect.eachPageSize,
+// página a página.
+func (s *sqlStore) Each(ctx context.Context, q ListQuery, fn func(User) error) (err error) {
+	if s.dialect.eachPageSize > 0 {
+		return s.eachPaged(ctx, q, fn)
+	}
+	querySQL, args := s.listSQL(q)
+
+	var count int64
+	ctx, end := s.startSpan(ctx, "SELECT", "users", querySQL)
+	defer func() { end(count, err) }()
+
+	rows, err := s.conn().QueryContext(ctx, s.dialect.rebind(querySQL), args...)
+	if err != nil {
+		return fmt.Errorf("erro ao buscar utilizadores: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var u User
+		if err := scanUser(rows, &u); err != nil {
+			return fmt.Errorf("erro ao ler utilizador: %v", err)
+		}
+		if err := fn(u); err != nil {
+			return err
+		}
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("erro durante a iteração das linhas de utilizadores: %v", err)
+	}
+	return nil
+}
+
+// eachPaged lê q em páginas por keyset e só chama fn depois de fechar cada
+// consulta. No SQLite a única conexão do pool ficaria presa enquanto fn
+// escreve para um cliente lento, bloqueando todas as outras requisições.
+// Utilizadores criados ou alterados entre páginas podem aparecer ou não.
+func (s *sqlStore) eachPaged(ctx context.Context, q ListQuery, fn func(User) error) error {
+	remaining := q.Limit
+	for {
+		page := q
+		page.Limit = s.dialect.eachPageSize
+		if remaining > 0 && remaining < page.Limit {
+			page.Limit = remaining
+		}
+		users, err := s.List(ctx, page)
+		if err != nil {
+			return err
+		}
+		for _, u := range users {
+			if err := fn(u); err != nil {
+				return err
+			}
+		}
+		if len(users) < page.Limit {
+			return nil
+		}
+		if remaining > 0 {
+			if remaining -= len(users); remaining == 0 {
+				return nil
+			}
+		}
+		q.After = cursorAfter(q, users[len(users)-1])
+	}
+}
+
+// listSQL monta o SELECT de List. O cursor vira uma comparação de tuplas,
+// (coluna, id) > ($a, $b), para que a página seguinte use o índice em vez de OFFSET.
+func (s *sqlStore) listSQL(q ListQuery) (string, []any) {
+	var where []string
+	var args []any
+	arg := func(v any) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	if q.EmailDomain != "" {
+		where = append(where, "lower(email) LIKE "+arg("%@"+q.EmailDomain))
+	}
+	if q.Status != "" {
+		where = append(where, "status = "+arg(q.Status))
+	}
+	if q.Role != "" {
+		where = append(where, "role = "+arg(q.Role))
+	}
+	if !q.CreatedFrom.IsZero() {
+		where = append(where, "created_at >= "+arg(s.dialect.timeArg(q.CreatedFrom)))
+	}
+	if !q.CreatedTo.IsZero() {
+		where = append(where, "created_at < "+arg(s.dialect.timeArg(q.CreatedTo)))
+	}
+
+	column := "id"
+	switch q.Sort {
+	case SortByUsername:
+		column = "username"
+	case SortByCreatedAt:
+		column = "created_at"
+	}
+	op, dir := ">", "ASC"
+	if q.Desc {
+		op, dir = "<", "DESC"
+	}
+	if c := q.After; c != nil {
+		switch q.Sort {
+		case SortByUsername:
+			where = append(where, "(username, id) "+op+" ("+arg(c.Username)+", "+arg(c.ID)+")")
+		case SortByCreatedAt:
+			where = append(where, "(created_at, id) "+op+" ("+arg(s.dialect.timeArg(c.CreatedAt))+", "+arg(c.ID)+")")
+		default:
+			where = append(where, "id "+op+" "+arg(c.ID))
+		}
+	}
+
+	querySQL := "SELECT " + userColumns + " FROM users"
+	if len(where) > 0 {
+		querySQL += " WHERE " + strings.Join(where, " AND ")
+	}
+	querySQL += " ORDER BY " + column + " " + dir
+	if column != "id" {
+		querySQL += ", id " + dir
+	}
+	if q.Limit > 0 {
+		querySQL += " LIMIT " + arg(q.Limit)
+	}
+	return querySQL, args
+}
+
+// queryUsers executa um SELECT das userColumns. Linhas que falham no Scan são
+// registradas e ignoradas.
+func (s *sqlStore) queryUsers(ctx context.Context, querySQL string, args ...any) (users []User, err error) {
+	ctx, end := s.startSpan(ctx, "SELECT", "users", querySQL)
+	defer func() { end(int64(len(users)), err) }()
+
+	rows, err := s.conn().QueryContext(ctx, s.dialect.rebind(querySQL), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for row := 0; rows.Next(); row++ {
+		var u User
+		if err := scanUser(rows, &u); err != nil {
+			slog.WarnContext(ctx, "Erro ao escanear linha do utilizador; linha ignorada",
+				"error", err, "row", row, "db.statement", querySQL)
+			continue
+		}
+		users = append(users, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("erro durante a iteração das linhas de utilizadores: %v", err)
+	}
+	return users, nil
+}
+
+func (s *sqlStore) Update(ctx context.Context, u User) (updated User, err error) {
+	updateSQL := `UPDATE users SET username = $1, email = $2, role = $3, status = $4, password_hash = $5, version = version + 1, updated_at = $6
+        WHERE id = $7 AND (version = $8 OR $8 = 0) RETURNING version`
+
+	var rowsAffected int64
+	ctx, end := s.startSpan(ctx, "UPDATE", "users", updateSQL)
+	defer func() { end(rowsAffected, err) }()
+
+	u.UpdatedAt = dbNow()
+	err = s.conn().QueryRowContext(ctx, s.dialect.rebind(updateSQL),
+		u.Username, u.Email, u.Role, u.Status, u.PasswordHash, s.dialect.timeArg(u.UpdatedAt), u.ID, u.Version).Scan(&u.Version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, s.missingOrConflict(ctx, u.ID)
+	}
+	if err != nil {
+		if dup := s.translate(err); dup != err {
+			return User{}, dup
+		}
+		return User{}, fmt.Errorf("erro ao atualizar utilizador %d: %v", u.ID, err)
+	}
+	rowsAffected = 1
+	u.PasswordHash = ""
+	return u, nil
+}
+
+func (s *sqlStore) Delete(ctx context.Context, id, version int64) (err error) {
+	deleteSQL := "DELETE FROM users WHERE id = $1 AND (version = $2 OR $2 = 0)"
+
+	var rowsAffected int64
+	ctx, end := s.startSpan(ctx, "DELETE", "users", deleteSQL)
+	defer func() { end(rowsAffected, err) }()
+
+	result, err := s.conn().ExecContext(ctx, s.dialect.rebind(deleteSQL), id, version)
+	if err != nil {
+		return fmt.Errorf("erro ao tentar eliminar utilizador com ID %d: %v", id, err)
+	}
+	rowsAffected, err = result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("erro ao verificar linhas afetadas após eliminar utilizador com ID %d: %v", id, err)
+	}
+	if rowsAffected == 0 {
+		return s.missingOrConflict(ctx, id)
+	}
+	return nil
+}
+
+// missingOrConflict explica por que um UPDATE ou DELETE condicionado à versão
+// não afetou linhas: o utilizador não existe (ErrNotFound) ou mudou de versão
+// (ErrVersionConflict).
+func (s *sqlStore) missingOrConflict(ctx context.Context, id int64) error {
+	_, err := s.getUser(ctx, "id", id)
+	switch {
+	case err == nil:
+		return ErrVersionConflict
+	case errors.Is(err, ErrNotFound):
+		return ErrNotFound
+	default:
+		return err
+	}
+}
+
+func (s *sqlStore) CreateSession(ctx context.Context, sess Session) (err error) {
+	insertSQL := "INSERT INTO sessions(id, user_id, kind, expires_at) VALUES ($1, $2, $3, $4)"
+
+	ctx, end := s.startSpan(ctx, "INSERT", "sessions", insertSQL)
+	defer func() { end(1, err) }()
+
+	if _, err = s.conn().ExecContext(ctx, s.dialect.rebind(insertSQL), sess.ID, sess.UserID, sess.Kind, s.dialect.timeArg(sess.ExpiresAt)); err != nil {
+		return fmt.Errorf("erro ao criar sessão: %v", err)
+	}
+	return nil
+}
+
+func (s *sqlStore) GetSessionUser(ctx context.Context, id, kind string, now time.Time) (user User, err error) {
+	querySQL := `SELECT u.id, u.username, u.email, u.role, u.status, u.version, u.created_at, u.updated_at FROM sessions s JOIN users u ON u.id = s.user_id
+        WHERE s.id = $1 AND s.kind = $2 AND s.expires_at > $3 AND u.status = 'active'`
+
+	var found int64
+	ctx, end := s.startSpan(ctx, "SELECT", "sessions", querySQL)
+	defer func() { end(found, err) }()
+
+	err = scanUser(s.conn().QueryRowContext(ctx, s.dialect.rebind(querySQL), id, kind, s.dialect.timeArg(now)), &user)
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, ErrSessionNotFound
+	}
+	if err != nil {
+		return User{}, fmt.Errorf("erro ao buscar sessão: %v", err)
+	}
+	found = 1
+	return user, nil
+}
+
+func (s *sqlStore) DeleteSession(ctx context.Context, id, kind string, now time.Time) (deleted bool, err error) {
+	deleteSQL := "DELETE FROM sessions WHERE id = $1 AND kind = $2 AND expires_at > $3"
+
+	var rowsAffected int64
+	ctx, end := s.startSpan(ctx, "DELETE", "sessions", deleteSQL)
+	defer func() { end(rowsAffected, err) }()
+
+	result, err := s.conn().ExecContext(ctx, s.dialect.rebind(deleteSQL), id, kind, s.dialect.timeArg(now))
+	if err != nil {
+		return false, fmt.Errorf("erro ao remover sessão: %v", err)
+	}
+	rowsAffected, err = result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("erro ao verificar linhas afetadas ao remover sessão: %v", err)
+	}
+	return rowsAffected > 0, nil
+}
+
+var dollarPlaceholder = regexp.MustCompile(`\$(\d+)`)
+
+// rebindQuestion troca $N por ?N, a forma posicional numerada do SQLite.
+func rebindQuestion(query string) string {
+	return dollarPlaceholder.ReplaceAllString(query, "?$1")
+}
+
+func (s *sqlStore) ReserveIdempotencyKey(ctx context.Context, rec IdempotencyRecord, now time.Time) (existing IdempotencyRecord, reserved bool, err error) {
+	// Um registo expirado é substituído no mesmo comando; o WHERE do
+	// DO UPDATE garante que, entre inserções simultâneas, só uma devolve a linha.
+	insertSQL := `INSERT INTO idempotency_keys(id, fingerprint, status, content_type, body, expires_at) VALUES ($1, $2, 0, '', NULL, $3)
+        ON CONFLICT (id) DO UPDATE SET fingerprint = excluded.fingerprint, status = 0, content_type = '', body = NULL, expires_at = excluded.expires_at
+        WHERE idempotency_keys.expires_at <= $4 RETURNING id`
+	querySQL := "SELECT fingerprint, status, content_type, body, expires_at FROM idempotency_keys WHERE id = $1"
+
+	var rows int64
+	ctx, end := s.startSpan(ctx, "INSERT", "idempotency_keys", insertSQL)
+	defer func() { end(rows, err) }()
+
+	// Se o registo existente for removido entre o INSERT e o SELECT, tenta de novo.
+	for range 3 {
+		var key string
+		err = s.conn().QueryRowContext(ctx, s.dialect.rebind(insertSQL),
+			rec.Key, rec.Fingerprint, s.dialect.timeArg(rec.ExpiresAt), s.dialect.timeArg(now)).Scan(&key)
+		if err == nil {
+			rows = 1
+			return IdempotencyRecord{}, true, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return IdempotencyRecord{}, false, fmt.Errorf("erro ao reservar chave de idempotência: %v", err)
+		}
+
+		existing = IdempotencyRecord{Key: rec.Key}
+		err = s.conn().QueryRowContext(ctx, s.dialect.rebind(querySQL), rec.Key).Scan(
+			&existing.Fingerprint, &existing.Status, &existing.ContentType, &existing.Body, dbTime{&existing.ExpiresAt})
+		if err == nil {
+			return existing, false, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return IdempotencyRecord{}, false, fmt.Errorf("erro ao buscar chave de idempotência: %v", err)
+		}
+	}
+	return IdempotencyRecord{}, false, fmt.Errorf("erro ao reservar chave de idempotência: registo removido repetidamente")
+}
+
+func (s *sqlStore) CompleteIdempotencyKey(ctx context.Context, rec IdempotencyRecord) (err error) {
+	updateSQL := "UPDATE idempotency_keys SET status = $2, content_type = $3, body = $4, expires_at = $5 WHERE id = $1"
+
+	var rowsAffected int64
+	ctx, end := s.startSpan(ctx, "UPDATE", "idempotency_keys", updateSQL)
+	defer func() { end(rowsAffected, err) }()
+
+	result, err := s.conn().ExecContext(ctx, s.dialect.rebind(updateSQL),
+		rec.Key, rec.Status, rec.ContentType, rec.Body, s.dialect.timeArg(rec.ExpiresAt))
+	if err != nil {
+		return fmt.Errorf("erro ao gravar resposta da chave de idempotência: %v", err)
+	}
+	if rowsAffected, err = result.RowsAffected(); err != nil {
+		return fmt.Errorf("erro ao verificar linhas afetadas ao gravar chave de idempotência: %v", err)
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *sqlStore) DeleteIdempotencyKey(ctx context.Context, key string) (err error) {
+	deleteSQL := "DELETE FROM idempotency_keys WHERE id = $1"
+
+	var rowsAffected int64
+	ctx, end := s.startSpan(ctx, "DELETE", "idempotency_keys", deleteSQL)
+	defer func() { end(rowsAffected, err) }()
+
+	result, err := s.conn().ExecContext(ctx, s.dialect.rebind(deleteSQL), key)
+	if err != nil {
+		return fmt.Errorf("erro ao remover chave de idempotência: %v", err)
+	}
+	rowsAffected, _ = result.RowsAffected()
+	return nil
+}
+
+func (s *sqlStore) DeleteExpiredIdempotencyKeys(ctx context.Context, now time.Time) (deleted int64, err error) {
+	deleteSQL := "DELETE FROM idempotency_keys WHERE expires_at <= $1"
+
+	ctx, end := s.startSpan(ctx, "DELETE", "idempotency_keys", deleteSQL)
+	defer func() { end(deleted, err) }()
+
+	result, err := s.conn().ExecContext(ctx, s.dialect.rebind(deleteSQL), s.dialect.timeArg(now))
+	if err != nil {
+		return 0, fmt.Errorf("erro ao remover chaves de idempotência expiradas: %v", err)
+	}
+	deleted, err = result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("erro ao verificar linhas afetadas ao remover chaves de idempotência: %v", err)
+	}
+	return deleted, nil
+}
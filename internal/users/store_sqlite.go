@@ -0,0 +1,152 @@
+package users
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// sqliteSchema espelha as migrações do Postgres. Os instantes (expiração das
+// sessões e das chaves de idempotência, created_at, updated_at) são gravados
+// em nanossegundos Unix para que a comparação seja numérica.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS users (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    username TEXT NOT NULL UNIQUE,
+    email TEXT NOT NULL UNIQUE,
+    password_hash TEXT NOT NULL,
+    role TEXT NOT NULL DEFAULT 'user' CHECK (role IN ('admin', 'user')),
+    status TEXT NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'disabled')),
+    version INTEGER NOT NULL DEFAULT 1,
+    created_at INTEGER NOT NULL DEFAULT 0,
+    updated_at INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS sessions (
+    id TEXT PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    kind TEXT NOT NULL,
+    expires_at INTEGER NOT NULL,
+    created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS sessions_user_id_idx ON sessions (user_id);
+
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    id TEXT PRIMARY KEY,
+    fingerprint TEXT NOT NULL,
+    status INTEGER NOT NULL DEFAULT 0,
+    content_type TEXT NOT NULL DEFAULT '',
+    body BLOB,
+    expires_at INTEGER NOT NULL,
+    created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idempotency_keys_expires_at_idx ON idempotency_keys (expires_at);
+`
+
+// sqliteAddedColumns são as colunas acrescentadas a users depois da primeira
+// versão do sqliteSchema; OpenSQLite cria as que faltarem em arquivos antigos.
+var sqliteAddedColumns = []struct{ name, definition string }{
+	{"version", "INTEGER NOT NULL DEFAULT 1"},
+	{"updated_at", "INTEGER NOT NULL DEFAULT 0"},
+	{"created_at", "INTEGER NOT NULL DEFAULT 0"},
+	{"status", "TEXT NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'disabled'))"},
+}
+
+// sqliteIndexes dependem das sqliteAddedColumns e por isso são criados depois delas.
+const sqliteIndexes = `
+CREATE INDEX IF NOT EXISTS users_created_at_id_idx ON users (created_at, id);
+CREATE INDEX IF NOT EXISTS users_username_id_idx ON users (username, id);
+`
+
+var sqliteDialect = sqlDialect{
+	name:        "sqlite",
+	system:      semconv.DBSystemSqlite,
+	like:        "LIKE",
+	schemaCheck: "SELECT count(*) > 0 FROM sqlite_master WHERE type = 'table' AND name = 'users'",
+	rebind:      rebindQuestion,
+	timeArg:     func(t time.Time) any { return t.UnixNano() },
+	uniqueColumn: func(err error) (string, bool) {
+		var sqliteErr *sqlite.Error
+		if !errors.As(err, &sqliteErr) || sqliteErr.Code() != sqlite3.SQLITE_CONSTRAINT_UNIQUE {
+			return "", false
+		}
+		// A mensagem tem a forma "UNIQUE constraint failed: users.username".
+		_, column, ok := strings.Cut(sqliteErr.Error(), "users.")
+		if !ok {
+			return "", false
+		}
+		column, _, _ = strings.Cut(column, " ")
+		return column, true
+	},
+	// Com uma única conexão, Each não pode mantê-la durante a exportação.
+	eachPageSize: 500,
+}
+
+// OpenSQLite abre (ou cria) o arquivo SQLite em path e garante o schema.
+// Use ":memory:" para um banco descartável.
+func OpenSQLite(ctx context.Context, path string) (Store, error) {
+	dsn := "file:" + path + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao abrir o banco SQLite '%s': %v", path, err)
+	}
+	// O SQLite aceita um único escritor; uma conexão evita SQLITE_BUSY e
+	// mantém um banco ":memory:" vivo entre as consultas.
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.ExecContext(ctx, sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("erro ao criar o schema SQLite: %v", err)
+	}
+	if err := addSQLiteColumns(ctx, db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("erro ao atualizar o schema SQLite: %v", err)
+	}
+
+	slog.Info("Banco de dados SQLite aberto.", "path", path)
+	return &sqlStore{db: db, dialect: sqliteDialect}, nil
+}
+
+// addSQLiteColumns acrescenta a users as sqliteAddedColumns que não existirem
+// e cria os sqliteIndexes.
+func addSQLiteColumns(ctx context.Context, db *sql.DB) error {
+	rows, err := db.QueryContext(ctx, "SELECT name FROM pragma_table_info('users')")
+	if err != nil {
+		return err
+	}
+	existing := map[string]bool{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		existing[name] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, c := range sqliteAddedColumns {
+		if existing[c.name] {
+			continue
+		}
+		if _, err := db.ExecContext(ctx, "ALTER TABLE users ADD COLUMN "+c.name+" "+c.definition); err != nil {
+			return err
+		}
+		slog.Info("Coluna acrescentada ao schema SQLite", "table", "users", "column", c.name)
+	}
+	_, err = db.ExecContext(ctx, sqliteIndexes)
+	return err
+}
@@ -0,0 +1,558 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// testStores são os armazenamentos exercitados por TestStores. O Postgres
+// partilha o sqlStore com o SQLite e só difere no dialeto.
+var testStores = []struct {
+	name string
+	open func(t *testing.T) Store
+}{
+	{"memory", func(*testing.T) Store { return NewMemoryStore() }},
+	{"sqlite", func(t *testing.T) Store {
+		store, err := OpenSQLite(context.Background(), filepath.Join(t.TempDir(), "usuarios.db"))
+		if err != nil {
+			t.Fatalf("OpenSQLite: %v", err)
+		}
+		t.Cleanup(func() { store.Close() })
+		return store
+	}},
+}
+
+// TestStores verifica que todas as implementações de Store têm a mesma
+// semântica, já que os testes e o desenvolvimento usam a memória e o SQLite
+// no lugar do Postgres.
+func TestStores(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, s Store)
+	}{
+		{"create conflicts", testCreateConflicts},
+		{"update version", testUpdateVersion},
+		{"delete version", testDeleteVersion},
+		{"list pagination", testListPagination},
+		{"list filters", testListFilters},
+		{"search", testSearch},
+		{"each", testEach},
+		{"transaction rollback", testTransactionRollback},
+		{"sessions", testSessions},
+		{"idempotency expiry", testIdempotencyExpiry},
+	}
+	for _, store := range testStores {
+		for _, tt := range tests {
+			t.Run(store.name+"/"+tt.name, func(t *testing.T) {
+				tt.run(t, store.open(t))
+			})
+		}
+	}
+}
+
+func mustCreate(t *testing.T, s UserStore, username string) User {
+	t.Helper()
+	u, err := s.Create(context.Background(), User{Username: username, Email: username + "@exemplo.com", PasswordHash: "hash-" + username})
+	if err != nil {
+		t.Fatalf("Create(%q): %v", username, err)
+	}
+	return u
+}
+
+// TestSQLiteEachUserPaged percorre uma exportação no SQLite, cuja única
+// conexão fica livre entre as páginas: fn grava no banco a cada utilizador.
+func TestSQLiteEachUserPaged(t *testing.T) {
+	store := testStores[1].open(t)
+	store.(*sqlStore).dialect.eachPageSize = 2
+	svc := NewService(store, testArgon2id)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, name := range []string{"ana", "bia", "caio", "duda", "edu"} {
+		mustCreate(t, store, name)
+	}
+
+	disabled := StatusDisabled
+	var got []string
+	err := svc.EachUser(ctx, ListQuery{Sort: SortByID}, func(u User) error {
+		if u.PasswordHash != "" {
+			t.Errorf("%s: EachUser devolveu o hash da senha", u.Username)
+		}
+		if _, err := svc.UpdateUser(ctx, u.ID, 0, UserUpdate{Status: &disabled}); err != nil {
+			return err
+		}
+		got = append(got, u.Username)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("EachUser: %v", err)
+	}
+	if want := []string{"ana", "bia", "caio", "duda", "edu"}; !slices.Equal(got, want) {
+		t.Errorf("EachUser: %v, quer %v", got, want)
+	}
+	active, err := store.List(ctx, ListQuery{Sort: SortByID, Status: StatusActive})
+	if err != nil || len(active) != 0 {
+		t.Errorf("List(active): %d utilizadores, erro %v; quer todos desativados", len(active), err)
+	}
+}
+
+func testCreateConflicts(t *testing.T, s Store) {
+	ctx := context.Background()
+	ana := mustCreate(t, s, "ana")
+	if ana.ID == 0 || ana.Version != 1 || ana.Role != RoleUser || ana.Status != StatusActive || ana.PasswordHash != "" {
+		t.Errorf("Create devolveu %+v, quer ID, versão 1, papel user, estado active e sem hash", ana)
+	}
+	if ana.CreatedAt.IsZero() || !ana.UpdatedAt.Equal(ana.CreatedAt) {
+		t.Errorf("Create: created_at %v, updated_at %v", ana.CreatedAt, ana.UpdatedAt)
+	}
+
+	tests := []struct {
+		name    string
+		user    User
+		wantErr error
+	}{
+		{"username repetido", User{Username: "ana", Email: "outra@exemplo.com", PasswordHash: "x"}, ErrUsernameTaken},
+		{"email repetido", User{Username: "outra", Email: "ana@exemplo.com", PasswordHash: "x"}, ErrEmailTaken},
+	}
+	for _, tt := range tests {
+		if _, err := s.Create(ctx, tt.user); !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: erro %v, quer %v", tt.name, err, tt.wantErr)
+		}
+	}
+
+	got, err := s.GetByUsername(ctx, "ana")
+	if err != nil {
+		t.Fatalf("GetByUsername: %v", err)
+	}
+	if got.ID != ana.ID || got.PasswordHash != "hash-ana" {
+		t.Errorf("GetByUsername devolveu %+v, quer o ID %d e o hash", got, ana.ID)
+	}
+	if _, err := s.GetByUsername(ctx, "ninguem"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetByUsername(ninguem): %v, quer ErrNotFound", err)
+	}
+	if got, err := s.GetByEmail(ctx, "ana@exemplo.com"); err != nil || got.ID != ana.ID {
+		t.Errorf("GetByEmail devolveu %+v, %v, quer o ID %d", got, err, ana.ID)
+	}
+	if _, err := s.GetByEmail(ctx, "ninguem@exemplo.com"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetByEmail(ninguem): %v, quer ErrNotFound", err)
+	}
+}
+
+func testUpdateVersion(t *testing.T, s Store) {
+	ctx := context.Background()
+	ana := mustCreate(t, s, "ana")
+	mustCreate(t, s, "bia")
+
+	ana.Email = "ana@novo.com"
+	ana.PasswordHash = "hash-ana"
+	updated, err := s.Update(ctx, ana)
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if updated.Version != 2 || updated.Email != "ana@novo.com" || updated.PasswordHash != "" {
+		t.Errorf("Update devolveu %+v, quer versão 2, o novo email e sem hash", updated)
+	}
+
+	tests := []struct {
+		name    string
+		change  func(u *User)
+		wantErr error
+	}{
+		{"versão desatualizada", func(u *User) { u.Version = 1 }, ErrVersionConflict},
+		{"username de outro", func(u *User) { u.Username = "bia" }, ErrUsernameTaken},
+		{"email de outro", func(u *User) { u.Email = "bia@exemplo.com" }, ErrEmailTaken},
+		{"inexistente", func(u *User) { u.ID = 999 }, ErrNotFound},
+	}
+	for _, tt := range tests {
+		u := updated
+		u.PasswordHash = "hash-ana"
+		tt.change(&u)
+		if _, err := s.Update(ctx, u); !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: erro %v, quer %v", tt.name, err, tt.wantErr)
+		}
+	}
+
+	// Versão 0 dispensa a verificação.
+	u := updated
+	u.Version, u.Role, u.PasswordHash = 0, RoleAdmin, "hash-novo"
+	if updated, err = s.Update(ctx, u); err != nil {
+		t.Fatalf("Update sem versão: %v", err)
+	}
+	got, err := s.GetByID(ctx, ana.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if got.Version != 3 || updated.Version != 3 || got.Role != RoleAdmin || got.PasswordHash != "hash-novo" {
+		t.Errorf("após as atualizações: %+v, quer versão 3, papel admin e o novo hash", got)
+	}
+}
+
+func testDeleteVersion(t *testing.T, s Store) {
+	ctx := context.Background()
+	ana := mustCreate(t, s, "ana")
+	ana.PasswordHash = "hash-ana"
+	if _, err := s.Update(ctx, ana); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if err := s.Delete(ctx, ana.ID, 1); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("Delete com versão desatualizada: %v, quer ErrVersionConflict", err)
+	}
+	if err := s.Delete(ctx, ana.ID, 2); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := s.GetByID(ctx, ana.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetByID após Delete: %v, quer ErrNotFound", err)
+	}
+	if err := s.Delete(ctx, ana.ID, 0); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Delete repetido: %v, quer ErrNotFound", err)
+	}
+}
+
+func testListPagination(t *testing.T, s Store) {
+	ctx := context.Background()
+	// Criados fora da ordem alfabética, para que as ordenações difiram.
+	names := []string{"carla", "ana", "edu", "bia", "duda"}
+	for _, name := range names {
+		mustCreate(t, s, name)
+	}
+	sorted := slices.Sorted(slices.Values(names))
+	reversed := slices.Clone(sorted)
+	slices.Reverse(reversed)
+	byCreation := slices.Clone(names)
+	newestFirst := slices.Clone(names)
+	slices.Reverse(newestFirst)
+
+	tests := []struct {
+		sort string
+		desc bool
+		want []string
+	}{
+		{SortByID, false, names},
+		{SortByID, true, newestFirst},
+		{SortByUsername, false, sorted},
+		{SortByUsername, true, reversed},
+		{SortByCreatedAt, false, byCreation},
+		{SortByCreatedAt, true, newestFirst},
+	}
+	svc := NewService(s, testArgon2id)
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s desc=%v", tt.sort, tt.desc), func(t *testing.T) {
+			var got []string
+			q := ListQuery{Limit: 2, Sort: tt.sort, Desc: tt.desc}
+			for pages := 0; ; pages++ {
+				if pages > len(names) {
+					t.Fatalf("a paginação não terminou: %v", got)
+				}
+				page, err := svc.ListUsers(ctx, q)
+				if err != nil {
+					t.Fatalf("ListUsers: %v", err)
+				}
+				for _, u := range page.Users {
+					if u.PasswordHash != "" {
+						t.Errorf("List devolveu o hash de %s", u.Username)
+					}
+					got = append(got, u.Username)
+				}
+				if page.NextCursor == "" {
+					break
+				}
+				if q.After, err = DecodeCursor(page.NextCursor); err != nil {
+					t.Fatalf("DecodeCursor: %v", err)
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("páginas %v, quer %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := svc.ListUsers(ctx, ListQuery{Sort: SortByUsername, After: &Cursor{Sort: SortByID}}); !errors.Is(err, ErrValidation) {
+		t.Errorf("cursor de outra ordenação: %v, quer ErrValidation", err)
+	}
+}
+
+func testListFilters(t *testing.T, s Store) {
+	ctx := context.Background()
+	mustCreate(t, s, "ana")
+	bia := mustCreate(t, s, "bia")
+	if _, err := s.Create(ctx, User{Username: "caio", Email: "caio@outro.org", PasswordHash: "x", Role: RoleAdmin}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	bia.Status, bia.PasswordHash = StatusDisabled, "hash-bia"
+	if _, err := s.Update(ctx, bia); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		q    ListQuery
+		want []string
+	}{
+		{"todos", ListQuery{}, []string{"ana", "bia", "caio"}},
+		{"domínio", ListQuery{EmailDomain: "exemplo.com"}, []string{"ana", "bia"}},
+		{"desativados", ListQuery{Status: StatusDisabled}, []string{"bia"}},
+		{"administradores", ListQuery{Role: RoleAdmin}, []string{"caio"}},
+		{"limite", ListQuery{Limit: 1}, []string{"ana"}},
+		{"criados no futuro", ListQuery{CreatedFrom: time.Now().Add(time.Hour)}, nil},
+	}
+	for _, tt := range tests {
+		tt.q.Sort = SortByID
+		list, err := s.List(ctx, tt.q)
+		if err != nil {
+			t.Fatalf("%s: List: %v", tt.name, err)
+		}
+		var got []string
+		for _, u := range list {
+			got = append(got, u.Username)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: %v, quer %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func testSearch(t *testing.T, s Store) {
+	ctx := context.Background()
+	for _, name := range []string{"carla", "ana", "Mariana", "bia"} {
+		mustCreate(t, s, name)
+	}
+
+	tests := []struct {
+		partial string
+		want    []string
+	}{
+		{"ana", []string{"ana", "Mariana"}},
+		{"ANA", []string{"ana", "Mariana"}},
+		{"zé", nil},
+	}
+	for _, tt := range tests {
+		found, err := s.SearchByUsername(ctx, tt.partial)
+		if err != nil {
+			t.Fatalf("SearchByUsername(%q): %v", tt.partial, err)
+		}
+		var got []string
+		for _, u := range found {
+			if u.PasswordHash != "" {
+				t.Errorf("%s devolvido com o hash da senha", u.Username)
+			}
+			got = append(got, u.Username)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("SearchByUsername(%q): %v, quer %v", tt.partial, got, tt.want)
+		}
+	}
+}
+
+func testEach(t *testing.T, s Store) {
+	// Páginas pequenas no SQLite, para percorrer várias.
+	if ss, ok := s.(*sqlStore); ok && ss.dialect.eachPageSize > 0 {
+		ss.dialect.eachPageSize = 2
+	}
+	// Um prazo curto transforma um bloqueio da conexão em falha, não em espera.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	names := []string{"carla", "ana", "edu", "bia", "duda"}
+	for _, name := range names {
+		mustCreate(t, s, name)
+	}
+	sorted := slices.Sorted(slices.Values(names))
+
+	tests := []struct {
+		name string
+		q    ListQuery
+		want []string
+	}{
+		{"todos", ListQuery{Sort: SortByID}, names},
+		{"por username", ListQuery{Sort: SortByUsername}, sorted},
+		{"limite a meio de uma página", ListQuery{Sort: SortByID, Limit: 3}, names[:3]},
+		{"limite múltiplo da página", ListQuery{Sort: SortByID, Limit: 4}, names[:4]},
+		{"filtro", ListQuery{Sort: SortByID, EmailDomain: "outro.org"}, nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		err := s.Each(ctx, tt.q, func(u User) error {
+			// O exportador não usa o Store aqui, mas outras requisições sim;
+			// no SQLite elas disputam a mesma conexão.
+			if _, err := s.GetByID(ctx, u.ID); err != nil {
+				return err
+			}
+			got = append(got, u.Username)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("%s: Each: %v", tt.name, err)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: %v, quer %v", tt.name, got, tt.want)
+		}
+	}
+
+	errStop := errors.New("parar")
+	calls := 0
+	err := s.Each(ctx, ListQuery{Sort: SortByID}, func(User) error {
+		calls++
+		return errStop
+	})
+	if !errors.Is(err, errStop) || calls != 1 {
+		t.Errorf("Each com erro de fn: %v após %d chamadas, quer o erro de fn após 1", err, calls)
+	}
+}
+
+func testTransactionRollback(t *testing.T, s Store) {
+	ctx := context.Background()
+	errAbort := errors.New("abortar")
+	err := s.WithTx(ctx, func(tx UserStore) error {
+		mustCreate(t, tx, "ana")
+		if _, err := tx.GetByUsername(ctx, "ana"); err != nil {
+			t.Errorf("GetByUsername dentro da transação: %v", err)
+		}
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Fatalf("WithTx: %v, quer o erro de fn", err)
+	}
+	if _, err := s.GetByUsername(ctx, "ana"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetByUsername após rollback: %v, quer ErrNotFound", err)
+	}
+
+	if err := s.WithTx(ctx, func(tx UserStore) error {
+		mustCreate(t, tx, "bia")
+		return nil
+	}); err != nil {
+		t.Fatalf("WithTx: %v", err)
+	}
+	if _, err := s.GetByUsername(ctx, "bia"); err != nil {
+		t.Errorf("GetByUsername após commit: %v", err)
+	}
+}
+
+func testSessions(t *testing.T, s Store) {
+	ctx := context.Background()
+	now := time.Now()
+	ana := mustCreate(t, s, "ana")
+	for _, sess := range []Session{
+		{ID: "s1", UserID: ana.ID, Kind: "session", ExpiresAt: now.Add(time.Hour)},
+		{ID: "s2", UserID: ana.ID, Kind: "session", ExpiresAt: now.Add(time.Hour)},
+		{ID: "r1", UserID: ana.ID, Kind: "refresh", ExpiresAt: now.Add(time.Hour)},
+	} {
+		if err := s.CreateSession(ctx, sess); err != nil {
+			t.Fatalf("CreateSession(%s): %v", sess.ID, err)
+		}
+	}
+
+	got, err := s.GetSessionUser(ctx, "s1", "session", now)
+	if err != nil {
+		t.Fatalf("GetSessionUser: %v", err)
+	}
+	if got.ID != ana.ID || got.PasswordHash != "" {
+		t.Errorf("GetSessionUser devolveu %+v, quer o utilizador %d sem hash", got, ana.ID)
+	}
+
+	tests := []struct {
+		name     string
+		id, kind string
+		now      time.Time
+	}{
+		{"inexistente", "nada", "session", now},
+		{"outro tipo", "s1", "refresh", now},
+		{"expirada", "s1", "session", now.Add(2 * time.Hour)},
+	}
+	for _, tt := range tests {
+		if _, err := s.GetSessionUser(ctx, tt.id, tt.kind, tt.now); !errors.Is(err, ErrSessionNotFound) {
+			t.Errorf("GetSessionUser %s: %v, quer ErrSessionNotFound", tt.name, err)
+		}
+		if deleted, err := s.DeleteSession(ctx, tt.id, tt.kind, tt.now); err != nil || deleted {
+			t.Errorf("DeleteSession %s: (%v, %v), quer (false, nil)", tt.name, deleted, err)
+		}
+	}
+
+	// Cada refresh token só pode ser revogado (usado) uma vez.
+	for i, want := range []bool{true, false} {
+		if deleted, err := s.DeleteSession(ctx, "r1", "refresh", now); err != nil || deleted != want {
+			t.Errorf("DeleteSession(r1) #%d: (%v, %v), quer (%v, nil)", i+1, deleted, err, want)
+		}
+	}
+
+	ana.Status, ana.PasswordHash = StatusDisabled, "hash-ana"
+	if ana, err = s.Update(ctx, ana); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if _, err := s.GetSessionUser(ctx, "s1", "session", now); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("GetSessionUser de utilizador desativado: %v, quer ErrSessionNotFound", err)
+	}
+
+	ana.Status, ana.PasswordHash = StatusActive, "hash-ana"
+	if _, err := s.Update(ctx, ana); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if err := s.Delete(ctx, ana.ID, 0); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := s.GetSessionUser(ctx, "s2", "session", now); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("GetSessionUser após apagar o utilizador: %v, quer ErrSessionNotFound", err)
+	}
+}
+
+func testIdempotencyExpiry(t *testing.T, s Store) {
+	ctx := context.Background()
+	now := time.Now()
+	rec := IdempotencyRecord{Key: "POST /registo k1", Fingerprint: "fp1", ExpiresAt: now.Add(time.Minute)}
+
+	if _, reserved, err := s.ReserveIdempotencyKey(ctx, rec, now); err != nil || !reserved {
+		t.Fatalf("primeira reserva: (%v, %v), quer (true, nil)", reserved, err)
+	}
+	existing, reserved, err := s.ReserveIdempotencyKey(ctx, IdempotencyRecord{Key: rec.Key, Fingerprint: "fp2", ExpiresAt: now.Add(time.Minute)}, now)
+	if err != nil || reserved {
+		t.Fatalf("reserva em andamento: (%v, %v), quer (false, nil)", reserved, err)
+	}
+	if existing.Fingerprint != "fp1" || existing.Status != 0 {
+		t.Errorf("registo em andamento %+v, quer fp1 e status 0", existing)
+	}
+
+	done := rec
+	done.Status, done.ContentType, done.Body, done.ExpiresAt = 201, "application/json", []byte(`{"id":1}`), now.Add(time.Hour)
+	if err := s.CompleteIdempotencyKey(ctx, done); err != nil {
+		t.Fatalf("CompleteIdempotencyKey: %v", err)
+	}
+	existing, reserved, err = s.ReserveIdempotencyKey(ctx, rec, now.Add(30*time.Minute))
+	if err != nil || reserved {
+		t.Fatalf("repetição: (%v, %v), quer (false, nil)", reserved, err)
+	}
+	if existing.Status != 201 || existing.ContentType != "application/json" || string(existing.Body) != `{"id":1}` {
+		t.Errorf("resposta guardada %+v, quer a de CompleteIdempotencyKey", existing)
+	}
+
+	// Expirada, a chave pode ser reservada de novo, e a resposta antiga some.
+	later := now.Add(2 * time.Hour)
+	retaken := IdempotencyRecord{Key: rec.Key, Fingerprint: "fp3", ExpiresAt: later.Add(time.Minute)}
+	if _, reserved, err := s.ReserveIdempotencyKey(ctx, retaken, later); err != nil || !reserved {
+		t.Fatalf("reserva após expirar: (%v, %v), quer (true, nil)", reserved, err)
+	}
+	existing, _, err = s.ReserveIdempotencyKey(ctx, rec, later)
+	if err != nil || existing.Fingerprint != "fp3" || existing.Status != 0 || len(existing.Body) != 0 {
+		t.Errorf("registo após nova reserva %+v (%v), quer fp3 sem resposta", existing, err)
+	}
+
+	other := IdempotencyRecord{Key: "POST /registo k2", Fingerprint: "fp", ExpiresAt: later.Add(time.Hour)}
+	if _, _, err := s.ReserveIdempotencyKey(ctx, other, later); err != nil {
+		t.Fatalf("ReserveIdempotencyKey(k2): %v", err)
+	}
+	deleted, err := s.DeleteExpiredIdempotencyKeys(ctx, later.Add(30*time.Minute))
+	if err != nil || deleted != 1 {
+		t.Errorf("DeleteExpiredIdempotencyKeys: (%d, %v), quer (1, nil)", deleted, err)
+	}
+	if err := s.CompleteIdempotencyKey(ctx, rec); !errors.Is(err, ErrNotFound) {
+		t.Errorf("CompleteIdempotencyKey de chave removida: %v, quer ErrNotFound", err)
+	}
+
+	if err := s.DeleteIdempotencyKey(ctx, other.Key); err != nil {
+		t.Fatalf("DeleteIdempotencyKey: %v", err)
+	}
+	if _, reserved, err := s.ReserveIdempotencyKey(ctx, other, later); err != nil || !reserved {
+		t.Errorf("reserva após DeleteIdempotencyKey: (%v, %v), quer (true, nil)", reserved, err)
+	}
+}
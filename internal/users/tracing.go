@@ -0,0 +1,44 @@
+package users
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer usa o TracerProvider global; sem um configurado (ex.: na CLI) os
+// spans são descartados.
+var tracer = otel.Tracer("usuarios/internal/users")
+
+// Atributos dos spans de banco de dados.
+const (
+	attrDBStatement    = attribute.Key("db.statement")
+	attrDBOperation    = attribute.Key("db.operation")
+	attrDBRowsAffected = attribute.Key("db.rows_affected")
+)
+
+// startDBSpan abre um span filho para uma operação SQL na tabela indicada;
+// system identifica o banco (semconv.DBSystemPostgreSQL, semconv.DBSystemSqlite).
+func startDBSpan(ctx context.Context, system attribute.KeyValue, operation, table, statement string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, operation+" "+table,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			system,
+			attrDBOperation.String(operation),
+			attrDBStatement.String(statement),
+		),
+	)
+}
+
+// endDBSpan registra o número de linhas afetadas e o erro (se houver) e encerra o span.
+func endDBSpan(span trace.Span, rowsAffected int64, err error) {
+	span.SetAttributes(attrDBRowsAffected.Int64(rowsAffected))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,374 @@
+// Package users reúne o domínio de utilizadores partilhado pelo servidor HTTP
+// e pela CLI: validação do cadastro, hash de senhas, autenticação e os
+// armazenamentos (Postgres, SQLite e memória).
+package users
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Papéis guardados na coluna users.role.
+const (
+	RoleAdmin = "admin"
+	RoleUser  = "user"
+)
+
+// Estados guardados na coluna users.status. Utilizadores desativados não
+// conseguem entrar nem usar sessões existentes.
+const (
+	StatusActive   = "active"
+	StatusDisabled = "disabled"
+)
+
+type User struct {
+	ID           int64  `json:"id"`
+	Username     string `json:"username"`
+	Email        string `json:"email"`
+	Role         string `json:"role"`
+	Status       string `json:"status"`
+	PasswordHash string `json:"-"`
+	// Version começa em 1 e é incrementada a cada Update; serve de ETag.
+	Version   int64     `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+var (
+	ErrInvalidCredentials = errors.New("credenciais inválidas")
+	// ErrValidation é satisfeito (via errors.Is) por todo *ValidationError.
+	ErrValidation = errors.New("dados inválidos")
+)
+
+// FieldError descreve o problema de um campo do cadastro.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError lista todos os campos inválidos de uma requisição.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		msgs[i] = f.Message
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrValidation
+}
+
+func (e *ValidationError) add(field, message string) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Message: message})
+}
+
+// errOrNil devolve e se algum campo foi marcado como inválido, ou nil.
+func (e *ValidationError) errOrNil() error {
+	if len(e.Fields) > 0 {
+		return e
+	}
+	return nil
+}
+
+func (e *ValidationError) checkUsername(username string) {
+	if username == "" {
+		e.add("username", "nome de utilizador não pode ser vazio")
+	}
+}
+
+func (e *ValidationError) checkEmail(email string) {
+	if email == "" {
+		e.add("email", "email não pode ser vazio")
+	} else if !strings.Contains(email, "@") {
+		e.add("email", "formato de email inválido")
+	}
+}
+
+// MaxPasswordBytes é o limite do bcrypt, que recusa senhas maiores. Vale
+// para todos os algoritmos, para que trocar PASSWORD_HASH_ALGORITHM não torne
+// inválidas senhas já aceitas.
+const MaxPasswordBytes = 72
+
+func (e *ValidationError) checkPassword(field, password string) {
+	switch {
+	case password == "":
+		e.add(field, "senha não pode ser vazia")
+	case len(password) < 6:
+		e.add(field, "senha deve ter pelo menos 6 caracteres")
+	case len(password) > MaxPasswordBytes:
+		e.add(field, fmt.Sprintf("senha não pode ter mais de %d bytes", MaxPasswordBytes))
+	}
+}
+
+// Service aplica as regras de cadastro e autenticação sobre um UserStore.
+type Service struct {
+	Store UserStore
+	// Hasher gera os novos hashes e define quando um hash antigo deve ser regravado.
+	Hasher PasswordHasher
+	// OnRehash, se definido, é chamado depois de cada tentativa de regravar no
+	// login um hash com algoritmo ou parâmetros antigos.
+	OnRehash func(ctx context.Context, user User, from, to string, err error)
+}
+
+func NewService(store UserStore, hasher PasswordHasher) *Service {
+	return &Service{Store: store, Hasher: hasher}
+}
+
+// normalizePassword remove os espaços das pontas da senha, como o cadastro
+// sempre fez; os hashes já gravados são de senhas assim normalizadas, então
+// cadastro, importação, troca de senha e login têm de fazer o mesmo.
+func normalizePassword(password string) string {
+	return strings.TrimSpace(password)
+}
+
+// validateRegistration devolve um *ValidationError com todos os campos
+// inválidos, ou nil.
+func validateRegistration(username, email, password string) error {
+	verr := &ValidationError{}
+	verr.checkUsername(username)
+	verr.checkEmail(email)
+	verr.checkPassword("password", password)
+	return verr.errOrNil()
+}
+
+// RegisterUser valida os dados e cria o utilizador com o papel padrão. Os
+// erros esperados satisfazem errors.Is com ErrValidation, ErrUsernameTaken ou
+// ErrEmailTaken.
+func (s *Service) RegisterUser(ctx context.Context, username, email, password string) (User, error) {
+	username = strings.TrimSpace(username)
+	email = strings.TrimSpace(email)
+	password = normalizePassword(password)
+
+	if err := validateRegistration(username, email, password); err != nil {
+		return User{}, err
+	}
+
+	passwordHash, err := s.Hasher.Hash(password)
+	if err != nil {
+		return User{}, fmt.Errorf("erro ao gerar hash da senha: %v", err)
+	}
+
+	newUser, err := s.Store.Create(ctx, User{Username: username, Email: email, PasswordHash: passwordHash})
+	if err != nil {
+		return User{}, conflictError(err, username, email, "erro ao inserir utilizador")
+	}
+	return newUser, nil
+}
+
+// conflictError acrescenta o valor repetido aos erros de unicidade do store;
+// os demais erros são embrulhados com msg.
+func conflictError(err error, username, email, msg string) error {
+	switch {
+	case errors.Is(err, ErrUsernameTaken):
+		return fmt.Errorf("%w: '%s'", ErrUsernameTaken, username)
+	case errors.Is(err, ErrEmailTaken):
+		return fmt.Errorf("%w: '%s'", ErrEmailTaken, email)
+	default:
+		return fmt.Errorf("%s: %v", msg, err)
+	}
+}
+
+// UserUpdate lista os campos alterados por UpdateUser; campos nil mantêm o
+// valor atual.
+type UserUpdate struct {
+	Username *string `json:"username"`
+	Email    *string `json:"email"`
+	// Status é StatusActive ou StatusDisabled.
+	Status *string `json:"status"`
+}
+
+// UpdateUser altera username e/ou email do utilizador id, com as mesmas regras
+// do cadastro, se ele ainda estiver na versão informada (0 dispensa a
+// verificação). Os erros esperados satisfazem errors.Is com ErrValidation,
+// ErrNotFound, ErrVersionConflict, ErrUsernameTaken ou ErrEmailTaken.
+func (s *Service) UpdateUser(ctx context.Context, id, version int64, upd UserUpdate) (User, error) {
+	verr := &ValidationError{}
+	if upd.Username != nil {
+		*upd.Username = strings.TrimSpace(*upd.Username)
+		verr.checkUsername(*upd.Username)
+	}
+	if upd.Email != nil {
+		*upd.Email = strings.TrimSpace(*upd.Email)
+		verr.checkEmail(*upd.Email)
+	}
+	if upd.Status != nil && *upd.Status != StatusActive && *upd.Status != StatusDisabled {
+		verr.add("status", "estado inválido; use active ou disabled")
+	}
+	if err := verr.errOrNil(); err != nil {
+		return User{}, err
+	}
+
+	user, err := s.getByID(ctx, id)
+	if err != nil {
+		return User{}, err
+	}
+	if upd.Username != nil {
+		user.Username = *upd.Username
+	}
+	if upd.Email != nil {
+		user.Email = *upd.Email
+	}
+	if upd.Status != nil {
+		user.Status = *upd.Status
+	}
+	user.Version = version
+
+	updated, err := s.Store.Update(ctx, user)
+	if errors.Is(err, ErrNotFound) || errors.Is(err, ErrVersionConflict) {
+		return User{}, fmt.Errorf("%w: ID %d", err, id)
+	}
+	if err != nil {
+		return User{}, conflictError(err, user.Username, user.Email, "erro ao atualizar utilizador")
+	}
+	return updated, nil
+}
+
+// ChangePassword troca a senha do utilizador id depois de conferir a senha
+// atual; uma senha atual errada devolve ErrInvalidCredentials. Como em
+// UpdateUser, version diferente de 0 exige que o utilizador esteja nessa versão.
+func (s *Service) ChangePassword(ctx context.Context, id, version int64, current, newPassword string) error {
+	current = normalizePassword(current)
+	newPassword = normalizePassword(newPassword)
+	verr := &ValidationError{}
+	if current == "" {
+		verr.add("current_password", "senha atual não pode ser vazia")
+	}
+	verr.checkPassword("new_password", newPassword)
+	if err := verr.errOrNil(); err != nil {
+		return err
+	}
+
+	user, err := s.getByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	ok, _, err := VerifyPassword(s.Hasher, user.PasswordHash, current)
+	if err != nil {
+		return fmt.Errorf("erro ao verificar senha do utilizador %d: %v", user.ID, err)
+	}
+	if !ok {
+		return ErrInvalidCredentials
+	}
+
+	user.PasswordHash, err = s.Hasher.Hash(newPassword)
+	if err != nil {
+		return fmt.Errorf("erro ao gerar hash da senha: %v", err)
+	}
+	if version != 0 {
+		user.Version = version
+	}
+	_, err = s.Store.Update(ctx, user)
+	if errors.Is(err, ErrNotFound) || errors.Is(err, ErrVersionConflict) {
+		return fmt.Errorf("%w: ID %d", err, id)
+	}
+	if err != nil {
+		return fmt.Errorf("erro ao alterar senha do utilizador %d: %v", user.ID, err)
+	}
+	return nil
+}
+
+// getByID devolve o utilizador com o hash da senha, ou um erro que satisfaz
+// errors.Is(err, ErrNotFound).
+func (s *Service) getByID(ctx context.Context, id int64) (User, error) {
+	user, err := s.Store.GetByID(ctx, id)
+	if errors.Is(err, ErrNotFound) {
+		return User{}, fmt.Errorf("%w: ID %d", ErrNotFound, id)
+	}
+	if err != nil {
+		return User{}, fmt.Errorf("erro ao buscar utilizador %d: %v", id, err)
+	}
+	return user, nil
+}
+
+// AuthenticateUser confere username e senha. Se a senha confere mas o hash
+// armazenado usa um algoritmo ou parâmetros antigos (ex.: SHA-256 sem salt),
+// o hash é regravado com o algoritmo atual.
+func (s *Service) AuthenticateUser(ctx context.Context, username, password string) (User, error) {
+	password = normalizePassword(password)
+	user, err := s.Store.GetByUsername(ctx, strings.TrimSpace(username))
+	if errors.Is(err, ErrNotFound) {
+		// Gera um hash mesmo assim para não revelar pela latência se o utilizador existe.
+		s.Hasher.Hash(password)
+		return User{}, ErrInvalidCredentials
+	}
+	if err != nil {
+		return User{}, err
+	}
+
+	ok, needsRehash, err := VerifyPassword(s.Hasher, user.PasswordHash, password)
+	if err != nil {
+		return User{}, fmt.Errorf("erro ao verificar senha do utilizador %d: %v", user.ID, err)
+	}
+	if !ok || user.Status == StatusDisabled {
+		return User{}, ErrInvalidCredentials
+	}
+
+	if needsRehash {
+		from := HashAlgorithm(user.PasswordHash)
+		err := s.rehashPassword(ctx, user, password)
+		if s.OnRehash != nil {
+			s.OnRehash(ctx, user, from, s.Hasher.Algorithm(), err)
+		}
+	}
+
+	user.PasswordHash = ""
+	return user, nil
+}
+
+func (s *Service) rehashPassword(ctx context.Context, user User, password string) error {
+	passwordHash, err := s.Hasher.Hash(password)
+	if err != nil {
+		return err
+	}
+	user.PasswordHash = passwordHash
+	_, err = s.Store.Update(ctx, user)
+	return err
+}
+
+// DeleteUserByID remove o utilizador se ele estiver na versão informada (0
+// dispensa a verificação); devolve um erro que satisfaz errors.Is com
+// ErrNotFound se ele não existir ou ErrVersionConflict se tiver sido alterado.
+func (s *Service) DeleteUserByID(ctx context.Context, id, version int64) error {
+	err := s.Store.Delete(ctx, id, version)
+	if errors.Is(err, ErrNotFound) || errors.Is(err, ErrVersionConflict) {
+		return fmt.Errorf("%w: ID %d", err, id)
+	}
+	return err
+}
+
+// HasAdmin informa se existe algum administrador, ativo ou não.
+func (s *Service) HasAdmin(ctx context.Context) (bool, error) {
+	admins, err := s.Store.List(ctx, ListQuery{Sort: SortByID, Role: RoleAdmin, Limit: 1})
+	if err != nil {
+		return false, fmt.Errorf("erro ao procurar administradores: %v", err)
+	}
+	return len(admins) > 0, nil
+}
+
+// SetUserRole altera o papel do utilizador e informa se houve mudança. Um
+// utilizador inexistente não é erro: nada muda.
+func (s *Service) SetUserRole(ctx context.Context, username, role string) (changed bool, err error) {
+	user, err := s.Store.GetByUsername(ctx, username)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("erro ao alterar papel do utilizador '%s': %v", username, err)
+	}
+	if user.Role == role {
+		return false, nil
+	}
+	user.Role = role
+	if _, err := s.Store.Update(ctx, user); err != nil {
+		return false, fmt.Errorf("erro ao alterar papel do utilizador '%s': %v", username, err)
+	}
+	return true, nil
+}